@@ -48,6 +48,9 @@ declare interface RestContext {
     cacheDuration: number;
     cacheKey: string;
     cacheGroups: string[];
+    cacheVary: string[];
+    staleWhileRevalidate: number;
+    staleIfError: number;
 
     getVariable(...keys: any): any;
     write(content: any): void;
@@ -55,6 +58,8 @@ declare interface RestContext {
     redirect(url: string, status?: number): void;
     redirectTrailingSlash(status?: number): void;
     internalServerError(): void;
+    startStreaming(): void;
+    flushStream(): void;
     end(): void;
     clone(): RestContext;
 }
@@ -67,6 +72,9 @@ declare interface RestRequest {
     method: string;
     query: { [key: string]: string[]; };
     cookies: Cookie[];
+    peer: string;
+    peerVerified: boolean;
+    peerCertificates: any[];
     direct: any;
 
     body(): Bytes;
@@ -230,11 +238,90 @@ declare namespace prudence {
     function start(startables: Startable | Startable[]): void;
     function setCache(backend: CacheBackend): void;
     function invalidateCacheGroup(group: string): void;
+    function setCachePurgers(...purgers: CachePurger[]): void;
+    function addCachePurger(purger: CachePurger): void;
+    function getCacheStats(): CacheStats;
+    function resetCacheStats(): void;
+    function listCacheEntries(prefix?: string, group?: string, limit?: number): CacheEntry[];
+    function listCacheGroups(): Record<string, string[]>;
+    function warmCache(config: CacheWarmerConfig): number;
     function setScheduler(scheduler: Scheduler): void;
     function schedule(cronPattern: string, f: () => void): void;
+    function publishEvent(channel: string, data: any, type?: string, id?: string): void;
+    function broadcast(room: string, message: any): void;
+    function fetch(url: string, options?: FetchOptions): FetchResponse;
+
+    interface FetchOptions {
+        method?: string;
+        headers?: Record<string, string>;
+        query?: Record<string, any>;
+        body?: any;
+        context?: RestContext;
+        timeout?: number;
+        retries?: number;
+        maxBodySize?: number;
+        cacheDuration?: number;
+        cacheGroups?: string | string[];
+    }
+
+    interface FetchResponse {
+        readonly url: string;
+        readonly status: number;
+        readonly header: Record<string, string[]>;
+        readonly body: Uint8Array;
+        readonly cached: boolean;
+
+        ok(): boolean;
+        contentType(): string;
+        text(): string;
+        data(format?: string): any;
+    }
+
+    class HttpClient {
+        constructor(config?: {
+            baseUrl?: string;
+            headers?: Record<string, string>;
+            timeout?: number;
+            retries?: number;
+            retryDelay?: number;
+            maxRetryDelay?: number;
+            maxBodySize?: number;
+            maxConnectionsPerHost?: number;
+            cacheDuration?: number;
+            cacheGroups?: string | string[];
+        });
+
+        fetch(url: string, options?: FetchOptions): FetchResponse;
+    }
 
     interface CacheBackend {}
-    
+
+    interface CacheStats {
+        entries: number;
+        size: number;
+        hits: number;
+        misses: number;
+        stores: number;
+        hitRatio: number;
+        groups: Record<string, CacheGroupStats>;
+        backend?: Record<string, any>;
+    }
+
+    interface CacheGroupStats {
+        entries: number;
+        size: number;
+        hits: number;
+        stores: number;
+        hitRatio: number;
+    }
+
+    interface CacheEntry {
+        key: string;
+        groups?: string[];
+        size: number;
+        expiration: Date;
+    }
+
     class TieredCache implements CacheBackend {
         constructor(config?: {
             caches?: CacheBackend[];
@@ -255,6 +342,40 @@ declare namespace prudence {
         });
     }
 
+    class DiskCache implements CacheBackend {
+        constructor(config: {
+            path: string;
+            maxSize?: number;
+            pruneFrequency?: number;
+        });
+    }
+
+    class RedisCache implements CacheBackend {
+        constructor(config?: {
+            address?: string;
+            username?: string;
+            password?: string;
+            database?: number;
+            prefix?: string;
+            timeout?: number;
+            poolSize?: number;
+        });
+    }
+
+    class PreEncodingCache implements CacheBackend {
+        constructor(config: {
+            cache: CacheBackend;
+            encodings?: string | string[];
+            levels?: Record<string, number>;
+            dropIdentity?: boolean;
+            minSize?: number;
+            contentTypes?: string | string[];
+            excludeContentTypes?: string | string[];
+            workers?: number;
+            queueSize?: number;
+        });
+    }
+
     class DistributedCache implements CacheBackend {
         constructor(config: {
             local: CacheBackend;
@@ -262,6 +383,29 @@ declare namespace prudence {
                 namespace?: string;
                 selector?: string;
             };
+            coalesce?: boolean;
+            coalesceTimeout?: number;
+            relayEvents?: boolean;
+        });
+    }
+
+    interface CachePurger {}
+
+    class WebhookPurger implements CachePurger {
+        constructor(config: {
+            url: string;
+            method?: string;
+            headers?: Record<string, string>;
+            timeout?: number;
+        });
+    }
+
+    class VarnishPurger implements CachePurger {
+        constructor(config: {
+            urls: string | string[];
+            method?: 'PURGE' | 'BAN';
+            header?: string;
+            timeout?: number;
         });
     }
 
@@ -279,16 +423,35 @@ declare namespace prudence {
     class Server implements Startable {
         constructor(config?: {
             name?: string;
-            address?: string;
+            engine?: 'nethttp' | 'fasthttp';
+            address?: string; // can also be "unix:/path" or "systemd:" or "systemd:name"
             port?: number;
+            socketMode?: number | string;
             protocol?: 'dual' | 'ipv6' | 'ipv4';
             tls?: {
                 certificate?: string;
                 key?: string;
                 generate?: boolean;
+                acme?: {
+                    hosts: string | string[];
+                    email?: string;
+                    directory?: string;
+                    cache?: string;
+                    challengeAddress?: string;
+                };
+                files?: {
+                    certificate: string;
+                    key: string;
+                }[];
+                watch?: boolean;
+                clientCA?: string;
+                clientAuth?: 'none' | 'request' | 'require' | 'verify' | 'requireAndVerify';
             };
+            http3?: boolean;
             ncsaLogFileSuffix?: string;
             debug?: boolean;
+            surrogateKeys?: boolean | string | string[];
+            compression?: CompressionConfig;
             handlerTimeout?: number;
             readHeaderTimeout?: number;
             readTimeout?: number;
@@ -325,12 +488,41 @@ declare namespace prudence {
 
     type RouteConfig = {
         name?: string;
+        hosts?: string | string[];
         paths?: string | string[];
+        methods?: string | string[];
+        headers?: Record<string, string>;
+        query?: Record<string, string>;
+        contentTypes?: string | string[];
         redirectTrailingSlashStatus?: number;
         variables?: { [key: string]: any; };
         handler?: Handler | HandleFunction;
     };
 
+    class Rewrite implements Handler {
+        constructor(config?: {
+            rules?: RewriteRule | RewriteRule[];
+            files?: string | string[];
+            handler?: Handler | HandleFunction;
+            trustProxy?: boolean;
+        });
+
+        handle: HandleFunction;
+    }
+
+    type RewriteRule = {
+        path?: string;
+        regex?: string;
+        to: string;
+        status?: number;
+        redirect?: boolean;
+        keepQuery?: boolean;
+        hosts?: string | string[];
+        schemes?: string | string[];
+        query?: Record<string, string>;
+        headers?: Record<string, string>;
+    };
+
     class Resource implements Handler {
         constructor(config?: {
             name?: string;
@@ -349,7 +541,12 @@ declare namespace prudence {
 
     type FacetConfig = {
         name?: string;
+        hosts?: string | string[];
         paths?: string | string[];
+        methods?: string | string[];
+        headers?: Record<string, string>;
+        query?: Record<string, string>;
+        contentTypes?: string | string[];
         redirectTrailingSlashStatus?: number;
         variables?: { [key: string]: any; };
         representations?: RepresentationConfig | RepresentationConfig[];
@@ -371,6 +568,7 @@ declare namespace prudence {
         redirectTrailingSlash?: boolean;
         redirectTrailingSlashStatus?: number;
         variables?: { [key: string]: any; };
+        compression?: CompressionConfig;
         prepare?: RepresentationHook;
         describe?: RepresentationHook;
         present?: RepresentationHook;
@@ -387,6 +585,44 @@ declare namespace prudence {
         };
     };
 
+    interface CompressionConfig {
+        encodings?: string | string[];
+        levels?: Record<string, number>;
+        minSize?: number;
+        contentTypes?: string | string[];
+        excludeContentTypes?: string | string[];
+        streaming?: boolean;
+    }
+
+    interface CacheWarmerConfig {
+        server?: Server;
+        handler?: Handler | HandleFunction;
+        urls?: string | string[];
+        sitemaps?: string | string[];
+        generate?: () => string[];
+        accept?: string | string[];
+        acceptEncodings?: string | string[];
+        host?: string;
+        concurrency?: number;
+        schedule?: string;
+        onStart?: boolean;
+    }
+
+    class CacheWarmer implements Startable {
+        constructor(config: CacheWarmerConfig);
+
+        start(): void;
+        stop(): void;
+    }
+
+    class CacheAdmin implements Handler {
+        constructor(config?: {
+            readOnly?: boolean;
+        });
+
+        handle: HandleFunction;
+    }
+
     class Static implements Handler {
         constructor(config?: {
             root?: string;
@@ -397,4 +633,74 @@ declare namespace prudence {
         handle: HandleFunction;
     }
 
+    interface WebSocketConnection {
+        readonly id: number;
+        readonly context: RestContext;
+        variables: Record<string, any>;
+
+        subprotocol(): string;
+        send(message: any): void;
+        sendBinary(message: any): void;
+        close(code?: number, reason?: string): void;
+        join(room: string): void;
+        leave(room: string): void;
+        rooms(): string[];
+        broadcast(room: string, message: any): void;
+    }
+
+    interface WebSocketHooks {
+        open?: (this: WebSocketConnection) => void;
+        message?: (this: WebSocketConnection, message: string | Uint8Array, binary: boolean) => void;
+        close?: (this: WebSocketConnection, code: number, reason: string) => void;
+    }
+
+    class WebSocket implements Handler {
+        constructor(config: WebSocketHooks & {
+            subprotocols?: string | string[];
+            originPatterns?: string | string[];
+            rooms?: string | string[];
+            readLimit?: number;
+            buffer?: number;
+            writeTimeout?: number;
+            hooks?: WebSocketHooks;
+        });
+
+        handle: HandleFunction;
+    }
+
+    class Proxy implements Handler, Startable {
+        constructor(config: {
+            upstreams: string | string[];
+            path?: string;
+            preserveHost?: boolean;
+            requestHeaders?: Record<string, string | null>;
+            responseHeaders?: Record<string, string | null>;
+            timeout?: number;
+            healthCheck?: string | {
+                path: string;
+                interval?: number;
+                timeout?: number;
+            };
+            cacheDuration?: number;
+            cacheGroups?: string | string[];
+            cacheVary?: string | string[];
+        });
+
+        handle: HandleFunction;
+
+        start(): void;
+        stop(): void;
+    }
+
+    class EventStream implements Handler {
+        constructor(config: {
+            channel: string;
+            keepAlive?: number;
+            retry?: number;
+            buffer?: number;
+        });
+
+        handle: HandleFunction;
+    }
+
 }
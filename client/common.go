@@ -0,0 +1,34 @@
+package client
+
+import (
+	"github.com/tliron/commonlog"
+	"github.com/tliron/go-ard"
+	"github.com/tliron/prudence/platform"
+	"github.com/tliron/prudence/rest"
+)
+
+var log = commonlog.GetLogger("prudence.client")
+
+func RegisterDefaultTypes() {
+	platform.RegisterType("HttpClient", CreateHttpClient,
+		"baseUrl",
+		"headers",
+		"timeout",
+		"retries",
+		"retryDelay",
+		"maxRetryDelay",
+		"maxBodySize",
+		"maxConnectionsPerHost",
+		"cacheDuration",
+		"cacheGroups",
+	)
+
+	// For [rest.Context.Fetch]
+	rest.FetchFunc = func(url string, options ard.StringMap) (any, error) {
+		if response, err := Fetch(url, options); err == nil {
+			return response, nil
+		} else {
+			return nil, err
+		}
+	}
+}
@@ -0,0 +1,85 @@
+package client
+
+import (
+	"fmt"
+	"mime"
+	"net/http"
+	"strings"
+
+	"github.com/tliron/go-ard"
+	"github.com/tliron/kutil/util"
+)
+
+//
+// FetchResponse
+//
+
+type FetchResponse struct {
+	URL    string
+	Status int
+	Header http.Header
+	Body   []byte
+	Cached bool // true if it came from the cache
+}
+
+// True if the status is 2xx.
+func (self *FetchResponse) Ok() bool {
+	return (self.Status >= 200) && (self.Status < 300)
+}
+
+func (self *FetchResponse) ContentType() string {
+	contentType, _, _ := mime.ParseMediaType(self.Header.Get("Content-Type"))
+	return contentType
+}
+
+func (self *FetchResponse) Text() string {
+	return util.BytesToString(self.Body)
+}
+
+// Supported formats are "json", "xjson", "yaml", "xml", "cbor", and
+// "messagepack". If format is empty, will try to set the format according to
+// the content type.
+func (self *FetchResponse) Data(format string) (ard.Value, error) {
+	if format == "" {
+		format = getFormat(self.ContentType())
+		if format == "" {
+			return nil, fmt.Errorf("cannot determine format from content type: %s", self.ContentType())
+		}
+	}
+
+	if value, _, err := ard.Decode(self.Body, format, false); err == nil {
+		value, _ = ard.ConvertMapsToStringMaps(value)
+		return value, nil
+	} else {
+		return nil, err
+	}
+}
+
+func getFormat(contentType string) string {
+	switch contentType {
+	case "application/json", "text/json":
+		return "json"
+	case "application/yaml", "application/x-yaml", "text/yaml":
+		return "yaml"
+	case "application/xml", "text/xml":
+		return "xml"
+	case "application/cbor":
+		return "cbor"
+	case "application/msgpack", "application/x-msgpack", "application/vnd.msgpack":
+		return "messagepack"
+	}
+
+	// Structured syntax suffixes, e.g. "application/problem+json"
+	switch {
+	case strings.HasSuffix(contentType, "+json"):
+		return "json"
+	case strings.HasSuffix(contentType, "+yaml"):
+		return "yaml"
+	case strings.HasSuffix(contentType, "+xml"):
+		return "xml"
+	case strings.HasSuffix(contentType, "+cbor"):
+		return "cbor"
+	default:
+		return ""
+	}
+}
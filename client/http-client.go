@@ -0,0 +1,516 @@
+package client
+
+import (
+	"bytes"
+	contextpkg "context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	urlpkg "net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/dop251/goja"
+	"github.com/tliron/commonjs-goja"
+	"github.com/tliron/commonjs-goja/api"
+	"github.com/tliron/go-ard"
+	"github.com/tliron/kutil/util"
+	"github.com/tliron/prudence/platform"
+	"github.com/tliron/prudence/rest"
+)
+
+const (
+	DEFAULT_TIMEOUT                  = 30 * time.Second
+	DEFAULT_RETRY_DELAY              = 200 * time.Millisecond
+	DEFAULT_MAX_RETRY_DELAY          = 30 * time.Second
+	DEFAULT_MAX_CONNECTIONS_PER_HOST = 16
+	DEFAULT_MAX_BODY_SIZE            = 10 * 1024 * 1024 // 10 MiB
+)
+
+var defaultHttpClient = NewHttpClient()
+
+var errBodyTooLarge = errors.New("response body is larger than the maximum")
+
+// Fetches with the default [HttpClient].
+func Fetch(url string, options ard.StringMap) (*FetchResponse, error) {
+	return defaultHttpClient.Fetch(url, options)
+}
+
+//
+// HttpClient
+//
+
+type HttpClient struct {
+	BaseURL       string // relative URLs are resolved against it
+	Headers       map[string]string
+	Timeout       time.Duration // for all attempts together
+	Retries       int           // only for idempotent methods
+	RetryDelay    time.Duration // doubled for every retry
+	MaxRetryDelay time.Duration // also limits "Retry-After", 0 for no limit
+	MaxBodySize   int64         // bytes, 0 for no limit
+	CacheDuration float64       // seconds, 0 to disable caching
+	CacheGroups   []string
+
+	client *http.Client
+}
+
+func NewHttpClient() *HttpClient {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.MaxConnsPerHost = DEFAULT_MAX_CONNECTIONS_PER_HOST
+	transport.MaxIdleConnsPerHost = DEFAULT_MAX_CONNECTIONS_PER_HOST
+
+	return &HttpClient{
+		Timeout:       DEFAULT_TIMEOUT,
+		RetryDelay:    DEFAULT_RETRY_DELAY,
+		MaxRetryDelay: DEFAULT_MAX_RETRY_DELAY,
+		MaxBodySize:   DEFAULT_MAX_BODY_SIZE,
+		client:        &http.Client{Transport: transport},
+	}
+}
+
+// ([platform.CreateFunc] signature)
+func CreateHttpClient(jsContext *commonjs.Context, config ard.StringMap) (any, error) {
+	config_ := ard.With(config).ConvertSimilar().NilMeansZero()
+
+	self := NewHttpClient()
+
+	self.BaseURL, _ = config_.Get("baseUrl").String()
+
+	if headers, ok := config_.Get("headers").StringMap(); ok {
+		self.Headers = make(map[string]string)
+		for name, value := range headers {
+			self.Headers[name] = fmt.Sprintf("%v", value)
+		}
+	}
+
+	if timeout, ok := config_.Get("timeout").Float(); ok {
+		self.Timeout = time.Duration(timeout * float64(time.Second))
+	}
+
+	if retries, ok := config_.Get("retries").Integer(); ok {
+		self.Retries = int(retries)
+	}
+
+	if retryDelay, ok := config_.Get("retryDelay").Float(); ok {
+		self.RetryDelay = time.Duration(retryDelay * float64(time.Second))
+	}
+
+	if maxRetryDelay, ok := config_.Get("maxRetryDelay").Float(); ok {
+		self.MaxRetryDelay = time.Duration(maxRetryDelay * float64(time.Second))
+	}
+
+	if maxBodySize, ok := config_.Get("maxBodySize").Integer(); ok {
+		self.MaxBodySize = maxBodySize
+	}
+
+	if maxConnectionsPerHost, ok := config_.Get("maxConnectionsPerHost").Integer(); ok {
+		// Requests beyond the limit will wait for a connection to be available
+		transport := self.client.Transport.(*http.Transport)
+		transport.MaxConnsPerHost = int(maxConnectionsPerHost)
+		transport.MaxIdleConnsPerHost = int(maxConnectionsPerHost)
+	}
+
+	self.CacheDuration, _ = config_.Get("cacheDuration").Float()
+	self.CacheGroups = platform.AsStringList(config_.Get("cacheGroups"))
+
+	return self, nil
+}
+
+// Options are "method", "headers", "query", "body", "context", "timeout",
+// "retries", "maxBodySize", "cacheDuration", and "cacheGroups". See
+// [FetchRequest].
+//
+// A body that is not a string or bytes will be encoded as JSON.
+func (self *HttpClient) Fetch(url string, options ard.StringMap) (*FetchResponse, error) {
+	request, err := self.NewFetchRequest(url, options)
+	if err != nil {
+		return nil, err
+	}
+	return self.Do(request)
+}
+
+// Uses the client's settings as defaults for the options.
+func (self *HttpClient) NewFetchRequest(url string, options ard.StringMap) (*FetchRequest, error) {
+	options_ := ard.With(options).ConvertSimilar().NilMeansZero()
+
+	url_, err := self.resolve(url)
+	if err != nil {
+		return nil, err
+	}
+
+	if query, ok := options_.Get("query").StringMap(); ok {
+		values := url_.Query()
+		for name, value := range query {
+			values.Set(name, fmt.Sprintf("%v", value))
+		}
+		url_.RawQuery = values.Encode()
+	}
+
+	request := FetchRequest{
+		Method:        http.MethodGet,
+		URL:           url_.String(),
+		Headers:       make(map[string]string),
+		Context:       contextpkg.Background(),
+		Timeout:       self.Timeout,
+		Retries:       self.Retries,
+		MaxBodySize:   self.MaxBodySize,
+		CacheDuration: self.CacheDuration,
+		CacheGroups:   self.CacheGroups,
+	}
+
+	if method, ok := options_.Get("method").String(); ok {
+		request.Method = method
+	}
+
+	for name, value := range self.Headers {
+		request.Headers[name] = value
+	}
+	if headers, ok := options_.Get("headers").StringMap(); ok {
+		for name, value := range headers {
+			request.Headers[name] = fmt.Sprintf("%v", value)
+		}
+	}
+
+	switch body := options_.Get("body").Value.(type) {
+	case nil:
+	case string:
+		request.Body = util.StringToBytes(body)
+	case []byte:
+		request.Body = body
+	case goja.ArrayBuffer:
+		request.Body = body.Bytes()
+	default:
+		var transcriber api.Transcribe
+		if body_, err := transcriber.Stringify(body, "json", ""); err == nil {
+			request.Body = util.StringToBytes(body_)
+			if _, ok := request.Headers["Content-Type"]; !ok {
+				request.Headers["Content-Type"] = "application/json"
+			}
+		} else {
+			return nil, err
+		}
+	}
+
+	switch context := options_.Get("context").Value.(type) {
+	case nil:
+	case *rest.Context:
+		// Use the deadline of the request we are handling
+		request.Context = context.Request.Direct.Context()
+	case contextpkg.Context:
+		request.Context = context
+	default:
+		return nil, fmt.Errorf("fetch \"context\" is not a context: %T", context)
+	}
+
+	if timeout, ok := options_.Get("timeout").Float(); ok {
+		request.Timeout = time.Duration(timeout * float64(time.Second))
+	}
+
+	if retries, ok := options_.Get("retries").Integer(); ok {
+		request.Retries = int(retries)
+	}
+
+	if maxBodySize, ok := options_.Get("maxBodySize").Integer(); ok {
+		request.MaxBodySize = maxBodySize
+	}
+
+	if cacheDuration, ok := options_.Get("cacheDuration").Float(); ok {
+		request.CacheDuration = cacheDuration
+	}
+
+	if cacheGroups := options_.Get("cacheGroups"); cacheGroups.Value != nil {
+		request.CacheGroups = platform.AsStringList(cacheGroups)
+	}
+
+	return &request, nil
+}
+
+func (self *HttpClient) Do(request *FetchRequest) (*FetchResponse, error) {
+	var cacheKey platform.CacheKey
+	var cacheBackend platform.CacheBackend
+	if (request.CacheDuration > 0.0) && (request.Method == http.MethodGet) {
+		if cacheBackend = platform.GetCacheBackend(); cacheBackend != nil {
+			cacheKey = request.cacheKey()
+			if response, ok := loadFetchResponse(cacheBackend, cacheKey, request.URL); ok {
+				return response, nil
+			}
+		}
+	}
+
+	context := request.Context
+	if context == nil {
+		context = contextpkg.Background()
+	}
+	if request.Timeout > 0 {
+		var cancel contextpkg.CancelFunc
+		context, cancel = contextpkg.WithTimeout(context, request.Timeout)
+		defer cancel()
+	}
+
+	for attempt := 0; ; attempt++ {
+		response, err := self.do(context, request)
+
+		if (attempt < request.Retries) && request.idempotent() && shouldRetry(context, response, err) {
+			delay := self.RetryDelay << attempt
+			if response != nil {
+				if retryAfter, ok := getRetryAfter(response.Header); ok {
+					delay = retryAfter
+				}
+			}
+			if (self.MaxRetryDelay > 0) && ((delay > self.MaxRetryDelay) || (delay < 0)) {
+				// (Negative if shifting overflowed)
+				delay = self.MaxRetryDelay
+			}
+
+			log.Debugf("retrying in %s: %s %s", delay, request.Method, request.URL)
+
+			select {
+			case <-time.After(delay):
+				continue
+			case <-context.Done():
+				return nil, context.Err()
+			}
+		}
+
+		if err != nil {
+			return nil, err
+		}
+
+		if (cacheKey != "") && (response.Status == http.StatusOK) {
+			if reason := uncacheableReason(response.Header); reason == "" {
+				storeFetchResponse(cacheBackend, cacheKey, response, request)
+			} else {
+				log.Debugf("not caching response: %s: %s", reason, request.URL)
+			}
+		}
+
+		return response, nil
+	}
+}
+
+func (self *HttpClient) do(context contextpkg.Context, request *FetchRequest) (*FetchResponse, error) {
+	var body io.Reader
+	if request.Body != nil {
+		body = bytes.NewReader(request.Body)
+	}
+
+	httpRequest, err := http.NewRequestWithContext(context, request.Method, request.URL, body)
+	if err != nil {
+		return nil, err
+	}
+
+	for name, value := range request.Headers {
+		httpRequest.Header.Set(name, value)
+	}
+
+	httpResponse, err := self.client.Do(httpRequest)
+	if err != nil {
+		return nil, err
+	}
+	defer httpResponse.Body.Close()
+
+	var reader io.Reader = httpResponse.Body
+	if request.MaxBodySize > 0 {
+		if httpResponse.ContentLength > request.MaxBodySize {
+			return nil, fmt.Errorf("%w: %d bytes: %s %s", errBodyTooLarge, request.MaxBodySize, request.Method, request.URL)
+		}
+		// Read one byte more so that we can tell if it's too large
+		reader = io.LimitReader(reader, request.MaxBodySize+1)
+	}
+
+	if body, err := io.ReadAll(reader); err == nil {
+		if (request.MaxBodySize > 0) && (int64(len(body)) > request.MaxBodySize) {
+			return nil, fmt.Errorf("%w: %d bytes: %s %s", errBodyTooLarge, request.MaxBodySize, request.Method, request.URL)
+		}
+
+		log.Debugf("%s %s: %s", request.Method, request.URL, httpResponse.Status)
+		return &FetchResponse{
+			URL:    request.URL,
+			Status: httpResponse.StatusCode,
+			Header: httpResponse.Header,
+			Body:   body,
+		}, nil
+	} else {
+		return nil, err
+	}
+}
+
+func (self *HttpClient) resolve(url string) (*urlpkg.URL, error) {
+	url_, err := urlpkg.Parse(url)
+	if err != nil {
+		return nil, err
+	}
+
+	if self.BaseURL != "" {
+		if baseUrl, err := urlpkg.Parse(self.BaseURL); err == nil {
+			url_ = baseUrl.ResolveReference(url_)
+		} else {
+			return nil, err
+		}
+	}
+
+	if (url_.Scheme == "") || (url_.Host == "") {
+		return nil, fmt.Errorf("URL is not absolute: %s", url_.String())
+	}
+
+	return url_, nil
+}
+
+// Network errors and temporary server errors.
+func shouldRetry(context contextpkg.Context, response *FetchResponse, err error) bool {
+	if context.Err() != nil {
+		return false
+	}
+
+	if err != nil {
+		return !errors.Is(err, contextpkg.Canceled) && !errors.Is(err, contextpkg.DeadlineExceeded) && !errors.Is(err, errBodyTooLarge)
+	}
+
+	switch response.Status {
+	case http.StatusTooManyRequests, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	default:
+		return false
+	}
+}
+
+// "Retry-After" is either seconds or an HTTP date.
+func getRetryAfter(header http.Header) (time.Duration, bool) {
+	retryAfter := strings.TrimSpace(header.Get("Retry-After"))
+	if retryAfter == "" {
+		return 0, false
+	}
+
+	if seconds, err := strconv.ParseInt(retryAfter, 10, 64); err == nil {
+		if seconds < 0 {
+			return 0, false
+		}
+		if seconds > int64(math.MaxInt64/time.Second) {
+			return math.MaxInt64, true
+		}
+		return time.Duration(seconds) * time.Second, true
+	}
+
+	if date, err := http.ParseTime(retryAfter); err == nil {
+		if delay := time.Until(date); delay > 0 {
+			return delay, true
+		}
+		return 0, true
+	}
+
+	return 0, false
+}
+
+// Returns an empty string if the response can be cached. Like the proxy, we
+// respect the upstream's wishes.
+func uncacheableReason(header http.Header) string {
+	for _, value := range header.Values(rest.HeaderCacheControl) {
+		for _, directive := range strings.Split(value, ",") {
+			directive = strings.ToLower(strings.TrimSpace(directive))
+			if index := strings.IndexByte(directive, '='); index != -1 {
+				// E.g. `private="Set-Cookie"`
+				directive = directive[:index]
+			}
+			switch directive {
+			case "private", "no-store", "no-cache":
+				return "Cache-Control: " + directive
+			}
+		}
+	}
+
+	return ""
+}
+
+func loadFetchResponse(cacheBackend platform.CacheBackend, key platform.CacheKey, url string) (*FetchResponse, bool) {
+	if cached, ok := cacheBackend.LoadRepresentation(key); ok && !cached.Expired() {
+		if body, _ := cached.GetBody(platform.EncodingTypeIdentity); body != nil {
+			platform.CountCacheHit(cached.Groups)
+			log.Debugf("cache hit: %s", key)
+			return &FetchResponse{
+				URL:    url,
+				Status: http.StatusOK,
+				Header: cached.Headers,
+				Body:   body,
+				Cached: true,
+			}, true
+		}
+	}
+
+	platform.CountCacheMiss()
+	return nil, false
+}
+
+func storeFetchResponse(cacheBackend platform.CacheBackend, key platform.CacheKey, response *FetchResponse, request *FetchRequest) {
+	groups := make([]platform.CacheKey, len(request.CacheGroups))
+	for index, group := range request.CacheGroups {
+		groups[index] = platform.CacheKey(group)
+	}
+
+	cached := platform.CachedRepresentation{
+		Groups:     groups,
+		Headers:    response.Header,
+		Body:       map[platform.EncodingType][]byte{platform.EncodingTypeIdentity: response.Body},
+		Expiration: time.Now().Add(time.Duration(request.CacheDuration * float64(time.Second))),
+	}
+
+	cacheBackend.StoreRepresentation(key, &cached)
+	platform.CountCacheStore(groups)
+	log.Debugf("cache store: %s", key)
+}
+
+//
+// FetchRequest
+//
+
+type FetchRequest struct {
+	Method        string
+	URL           string
+	Headers       map[string]string
+	Body          []byte
+	Context       contextpkg.Context // for cancellation and deadline
+	Timeout       time.Duration      // for all attempts together
+	Retries       int
+	MaxBodySize   int64   // bytes, 0 for no limit
+	CacheDuration float64 // seconds
+	CacheGroups   []string
+}
+
+func (self *FetchRequest) idempotent() bool {
+	switch self.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodPut, http.MethodDelete, http.MethodTrace:
+		return true
+	default:
+		return false
+	}
+}
+
+// We hash the headers so that sensitive ones (e.g. "Authorization") will not
+// appear in cache keys, which are logged and possibly shared with other nodes.
+func (self *FetchRequest) cacheKey() platform.CacheKey {
+	header := make(http.Header)
+	for name, value := range self.Headers {
+		header.Set(name, value)
+	}
+
+	names := make([]string, 0, len(header))
+	for name := range header {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	hash := sha256.New()
+	for _, name := range names {
+		io.WriteString(hash, name)
+		hash.Write([]byte{0})
+		io.WriteString(hash, header.Get(name))
+		hash.Write([]byte{1})
+	}
+
+	return platform.CacheKey("fetch" + platform.CACHE_KEY_SEPARATOR + self.URL + platform.CACHE_KEY_SEPARATOR + hex.EncodeToString(hash.Sum(nil)))
+}
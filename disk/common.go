@@ -0,0 +1,16 @@
+package disk
+
+import (
+	"github.com/tliron/commonlog"
+	"github.com/tliron/prudence/platform"
+)
+
+var log = commonlog.GetLogger("prudence.disk")
+
+func RegisterDefaultTypes() {
+	platform.RegisterType("DiskCache", CreateDiskCacheBackend,
+		"path",
+		"maxSize",
+		"pruneFrequency",
+	)
+}
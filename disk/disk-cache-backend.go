@@ -0,0 +1,445 @@
+package disk
+
+import (
+	"container/list"
+	"errors"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/tliron/commonjs-goja"
+	"github.com/tliron/go-ard"
+	"github.com/tliron/kutil/util"
+	"github.com/tliron/prudence/memory"
+	"github.com/tliron/prudence/platform"
+)
+
+//
+// DiskCacheBackend
+//
+// Stores each representation in its own file. The index (including cache
+// groups) is kept in memory and rebuilt from the files on startup, so that
+// the cache survives restarts. When the total size exceeds the maximum the
+// least recently used representations are evicted.
+//
+// Stores and deletes happen in the background, but always in the order in
+// which they were called, so that a delete cannot be overtaken by an earlier
+// store.
+//
+
+type DiskCacheBackend struct {
+	Path    string
+	MaxSize int64
+
+	entries   map[platform.CacheKey]*diskEntry
+	recent    *list.List // front is most recently used
+	totalSize int64
+	groups    memory.CacheGroups
+	versions  uint64
+	lock      sync.Mutex
+	pruning   chan struct{}
+
+	mutations     []func()
+	mutating      bool
+	mutationsLock sync.Mutex
+}
+
+type diskEntry struct {
+	key        platform.CacheKey
+	path       string
+	size       int64
+	expiration time.Time
+	version    uint64 // changes whenever the file is replaced
+	element    *list.Element
+}
+
+func NewDiskCacheBackend(path string, maxSize int64) *DiskCacheBackend {
+	return &DiskCacheBackend{
+		Path:    path,
+		MaxSize: maxSize,
+		entries: make(map[platform.CacheKey]*diskEntry),
+		recent:  list.New(),
+		groups:  make(memory.CacheGroups),
+		pruning: make(chan struct{}),
+	}
+}
+
+// ([platform.CreateFunc] signature)
+func CreateDiskCacheBackend(jsContext *commonjs.Context, config ard.StringMap) (any, error) {
+	var path string
+	var maxSize int64
+	var pruneFrequency float64
+
+	config_ := ard.With(config).ConvertSimilar().NilMeansZero()
+	var ok bool
+	if path, ok = config_.Get("path").String(); !ok {
+		return nil, errors.New("DiskCache must have a \"path\"")
+	}
+	if maxSize, ok = config_.Get("maxSize").Integer(); !ok {
+		maxSize = 10737418240 // 10 GiB
+	}
+	if pruneFrequency, ok = config_.Get("pruneFrequency").Float(); !ok {
+		pruneFrequency = 60.0 // seconds
+	}
+
+	self := NewDiskCacheBackend(path, maxSize)
+
+	if err := self.Rebuild(); err != nil {
+		return nil, err
+	}
+
+	self.StartPruning(pruneFrequency)
+	util.OnExit(self.StopPruning)
+	return self, nil
+}
+
+// ([platform.CacheBackend] interface)
+func (self *DiskCacheBackend) LoadRepresentation(key platform.CacheKey) (*platform.CachedRepresentation, bool) {
+	self.lock.Lock()
+	entry, ok := self.entries[key]
+	if !ok {
+		self.lock.Unlock()
+		return nil, false
+	}
+	if time.Now().After(entry.expiration) {
+		log.Debug("cache expired", "key", key)
+		self.delete(key)
+		self.lock.Unlock()
+		return nil, false
+	}
+	self.recent.MoveToFront(entry.element)
+	path := entry.path
+	version := entry.version
+	self.lock.Unlock()
+
+	if cached, err := ReadEntry(path); err == nil {
+		return cached, true
+	} else {
+		log.Warningf("could not read entry: %s", err.Error())
+		self.lock.Lock()
+		// Unless it was replaced in the meantime
+		if entry, ok := self.entries[key]; ok && (entry.version == version) {
+			self.delete(key)
+		}
+		self.lock.Unlock()
+		return nil, false
+	}
+}
+
+// ([platform.CacheBackend] interface)
+func (self *DiskCacheBackend) StoreRepresentation(key platform.CacheKey, cached *platform.CachedRepresentation) {
+	self.mutate(func() {
+		// Write to a temporary file first so that readers never see a partial
+		// entry
+		temporaryPath, err := WriteTemporaryEntry(self.Path, key, cached)
+		if err != nil {
+			log.Errorf("could not write entry: %s", err.Error())
+			return
+		}
+
+		remove := func() {
+			if err := os.Remove(temporaryPath); err != nil {
+				log.Warning(err.Error())
+			}
+		}
+
+		fileInfo, err := os.Stat(temporaryPath)
+		if err != nil {
+			log.Errorf("could not write entry: %s", err.Error())
+			remove()
+			return
+		}
+
+		self.lock.Lock()
+		defer self.lock.Unlock()
+
+		// Within the lock, so that expiration and pruning won't delete the new
+		// file before it is in the index
+		path := filepath.Join(self.Path, EntryFilename(key))
+		if err := os.Rename(temporaryPath, path); err != nil {
+			log.Errorf("could not write entry: %s", err.Error())
+			remove()
+			return
+		}
+
+		self.add(key, path, fileInfo.Size(), cached.Retention())
+		self.groups.Add(key, cached, self.getExpiration)
+		self.evict()
+	})
+}
+
+// ([platform.CacheBackend] interface)
+func (self *DiskCacheBackend) DeleteRepresentation(key platform.CacheKey) {
+	self.mutate(func() {
+		self.lock.Lock()
+		defer self.lock.Unlock()
+
+		self.delete(key)
+	})
+}
+
+// ([platform.CacheBackend] interface)
+func (self *DiskCacheBackend) DeleteGroup(name platform.CacheKey) {
+	self.mutate(func() {
+		self.lock.Lock()
+		defer self.lock.Unlock()
+
+		self.groups.Delete(name, self.delete)
+	})
+}
+
+// ([platform.CacheInspector] interface)
+func (self *DiskCacheBackend) IterateEntries(iterate func(entry *platform.CacheEntry) bool) {
+	self.lock.Lock()
+	groups := make(map[platform.CacheKey][]platform.CacheKey)
+	for name, group := range self.groups {
+		for _, key := range group.Keys {
+			groups[key] = append(groups[key], name)
+		}
+	}
+
+	now := time.Now()
+	entries := make([]*platform.CacheEntry, 0, len(self.entries))
+	for key, entry := range self.entries {
+		if now.Before(entry.expiration) {
+			entries = append(entries, &platform.CacheEntry{
+				Key:        key,
+				Groups:     groups[key],
+				Size:       entry.size,
+				Expiration: entry.expiration,
+			})
+		}
+	}
+	self.lock.Unlock()
+
+	for _, entry := range entries {
+		if !iterate(entry) {
+			return
+		}
+	}
+}
+
+// ([platform.CacheInspector] interface)
+func (self *DiskCacheBackend) GetMetrics() map[string]any {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+
+	return map[string]any{
+		"path":    self.Path,
+		"size":    self.totalSize,
+		"maxSize": self.MaxSize,
+	}
+}
+
+// Reads the metadata of all files in the directory. Expired, corrupt, and
+// temporary files are deleted.
+func (self *DiskCacheBackend) Rebuild() error {
+	if err := os.MkdirAll(self.Path, 0700); err != nil {
+		return err
+	}
+
+	dirEntries, err := os.ReadDir(self.Path)
+	if err != nil {
+		return err
+	}
+
+	type rebuildEntry struct {
+		metadata *EntryMetadata
+		path     string
+		size     int64
+		modified time.Time
+	}
+
+	var rebuildEntries []rebuildEntry
+	now := time.Now()
+
+	remove := func(path string) {
+		if err := os.Remove(path); err != nil {
+			log.Warning(err.Error())
+		}
+	}
+
+	for _, dirEntry := range dirEntries {
+		name := dirEntry.Name()
+		path := filepath.Join(self.Path, name)
+
+		if dirEntry.IsDir() {
+			continue
+		}
+
+		if !strings.HasSuffix(name, FILE_EXTENSION) {
+			if strings.HasPrefix(name, ".tmp-") {
+				// Left over from an interrupted write
+				remove(path)
+			}
+			continue
+		}
+
+		metadata, err := ReadEntryMetadata(path)
+		if err != nil {
+			log.Warningf("deleting corrupt entry: %s", path)
+			remove(path)
+			continue
+		}
+
+		if now.After(metadata.Expiration) {
+			remove(path)
+			continue
+		}
+
+		if fileInfo, err := dirEntry.Info(); err == nil {
+			rebuildEntries = append(rebuildEntries, rebuildEntry{metadata, path, fileInfo.Size(), fileInfo.ModTime()})
+		}
+	}
+
+	// We don't know when entries were last used, so we will use the time they were stored
+	sort.Slice(rebuildEntries, func(i int, j int) bool {
+		return rebuildEntries[i].modified.Before(rebuildEntries[j].modified)
+	})
+
+	self.lock.Lock()
+	defer self.lock.Unlock()
+
+	for _, rebuildEntry := range rebuildEntries {
+		metadata := rebuildEntry.metadata
+		self.add(metadata.Key, rebuildEntry.path, rebuildEntry.size, metadata.Expiration)
+		self.groups.Add(metadata.Key, &platform.CachedRepresentation{Groups: metadata.Groups}, self.getExpiration)
+	}
+
+	self.evict()
+
+	log.Infof("rebuilt index: %d representations, %d bytes", len(self.entries), self.totalSize)
+
+	return nil
+}
+
+func (self *DiskCacheBackend) Prune() {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+
+	now := time.Now()
+	for key, entry := range self.entries {
+		if now.After(entry.expiration) {
+			log.Debug("pruning representation", "key", key)
+			self.delete(key)
+		}
+	}
+
+	self.groups.Prune(self.getExpiration)
+}
+
+func (self *DiskCacheBackend) StartPruning(frequencySeconds float64) {
+	ticker := time.NewTicker(time.Duration(frequencySeconds * float64(time.Second)))
+	go func() {
+		for {
+			select {
+			case <-ticker.C:
+				self.Prune()
+
+			case <-self.pruning:
+				ticker.Stop()
+				return
+			}
+		}
+	}()
+}
+
+func (self *DiskCacheBackend) StopPruning() {
+	close(self.pruning)
+}
+
+// Queues the mutation. Mutations are run one at a time, in order, by a
+// background goroutine that exits when the queue is empty.
+func (self *DiskCacheBackend) mutate(mutation func()) {
+	self.mutationsLock.Lock()
+	defer self.mutationsLock.Unlock()
+
+	self.mutations = append(self.mutations, mutation)
+	if !self.mutating {
+		self.mutating = true
+		go self.runMutations()
+	}
+}
+
+func (self *DiskCacheBackend) runMutations() {
+	for {
+		self.mutationsLock.Lock()
+		if len(self.mutations) == 0 {
+			self.mutating = false
+			self.mutationsLock.Unlock()
+			return
+		}
+		mutation := self.mutations[0]
+		self.mutations[0] = nil
+		self.mutations = self.mutations[1:]
+		self.mutationsLock.Unlock()
+
+		mutation()
+	}
+}
+
+// Call within lock
+func (self *DiskCacheBackend) add(key platform.CacheKey, path string, size int64, expiration time.Time) {
+	if entry, ok := self.entries[key]; ok {
+		// Replace (the file was already overwritten)
+		self.totalSize -= entry.size
+		entry.size = size
+		entry.expiration = expiration
+		entry.version = self.nextVersion()
+		self.recent.MoveToFront(entry.element)
+	} else {
+		entry = &diskEntry{
+			key:        key,
+			path:       path,
+			size:       size,
+			expiration: expiration,
+			version:    self.nextVersion(),
+		}
+		entry.element = self.recent.PushFront(entry)
+		self.entries[key] = entry
+	}
+
+	self.totalSize += size
+}
+
+// Call within lock
+func (self *DiskCacheBackend) nextVersion() uint64 {
+	self.versions++
+	return self.versions
+}
+
+// Call within lock
+func (self *DiskCacheBackend) delete(key platform.CacheKey) {
+	if entry, ok := self.entries[key]; ok {
+		delete(self.entries, key)
+		self.recent.Remove(entry.element)
+		self.totalSize -= entry.size
+
+		if err := os.Remove(entry.path); (err != nil) && !errors.Is(err, os.ErrNotExist) {
+			log.Warning(err.Error())
+		}
+	}
+}
+
+// Call within lock
+func (self *DiskCacheBackend) evict() {
+	for (self.totalSize > self.MaxSize) && (self.recent.Len() > 0) {
+		entry := self.recent.Back().Value.(*diskEntry)
+		log.Debug("evicting representation", "key", entry.key)
+		self.delete(entry.key)
+	}
+}
+
+// ([memory.GetExpirationFunc] signature)
+// Call within lock
+func (self *DiskCacheBackend) getExpiration(key platform.CacheKey) (time.Time, bool) {
+	if entry, ok := self.entries[key]; ok {
+		if time.Now().Before(entry.expiration) {
+			return entry.expiration, true
+		}
+	}
+	return time.Time{}, false
+}
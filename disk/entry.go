@@ -0,0 +1,130 @@
+package disk
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/fxamacker/cbor/v2"
+	"github.com/tliron/commonlog"
+	"github.com/tliron/prudence/platform"
+)
+
+const FILE_EXTENSION = ".cbor"
+
+//
+// EntryMetadata
+//
+// Stored as the first CBOR item in each file so that we can rebuild the
+// index without reading the bodies.
+//
+
+type EntryMetadata struct {
+	Key        platform.CacheKey
+	Groups     []platform.CacheKey
+	Expiration time.Time // when the entry can be discarded
+}
+
+func EntryFilename(key platform.CacheKey) string {
+	hash := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(hash[:]) + FILE_EXTENSION
+}
+
+func WriteEntry(path string, key platform.CacheKey, cached *platform.CachedRepresentation) error {
+	// Write to a temporary file first so that readers never see a partial entry
+	if temporaryPath, err := WriteTemporaryEntry(filepath.Dir(path), key, cached); err == nil {
+		if err := os.Rename(temporaryPath, path); err == nil {
+			return nil
+		} else {
+			commonlog.CallAndLogWarning(func() error {
+				return os.Remove(temporaryPath)
+			}, "WriteEntry", log)
+			return err
+		}
+	} else {
+		return err
+	}
+}
+
+// Writes the entry to a new temporary file in the directory and returns its
+// path. The caller should rename it to the entry's path.
+func WriteTemporaryEntry(directory string, key platform.CacheKey, cached *platform.CachedRepresentation) (string, error) {
+	if file, err := os.CreateTemp(directory, ".tmp-*"); err == nil {
+		writer := bufio.NewWriter(file)
+		encoder := cbor.NewEncoder(writer)
+
+		err := encoder.Encode(EntryMetadata{
+			Key:        key,
+			Groups:     cached.Groups,
+			Expiration: cached.Retention(),
+		})
+		if err == nil {
+			err = encoder.Encode(cached)
+		}
+		if err == nil {
+			err = writer.Flush()
+		}
+
+		if err_ := file.Close(); err == nil {
+			err = err_
+		}
+
+		if err != nil {
+			commonlog.CallAndLogWarning(func() error {
+				return os.Remove(file.Name())
+			}, "WriteTemporaryEntry", log)
+			return "", err
+		}
+
+		return file.Name(), nil
+	} else {
+		return "", err
+	}
+}
+
+func ReadEntryMetadata(path string) (*EntryMetadata, error) {
+	if file, err := os.Open(path); err == nil {
+		defer commonlog.CallAndLogWarning(file.Close, "ReadEntryMetadata", log)
+
+		var metadata EntryMetadata
+		if err := cbor.NewDecoder(bufio.NewReader(file)).Decode(&metadata); err == nil {
+			return &metadata, nil
+		} else {
+			return nil, err
+		}
+	} else {
+		return nil, err
+	}
+}
+
+func ReadEntry(path string) (*platform.CachedRepresentation, error) {
+	if file, err := os.Open(path); err == nil {
+		defer commonlog.CallAndLogWarning(file.Close, "ReadEntry", log)
+
+		decoder := cbor.NewDecoder(bufio.NewReader(file))
+
+		// Skip metadata
+		var metadata cbor.RawMessage
+		if err := decoder.Decode(&metadata); err != nil {
+			return nil, err
+		}
+
+		var cached platform.CachedRepresentation
+		if err := decoder.Decode(&cached); err == nil {
+			if cached.Body == nil {
+				cached.Body = make(map[platform.EncodingType][]byte)
+			}
+			return &cached, nil
+		} else if err == io.EOF {
+			return nil, io.ErrUnexpectedEOF
+		} else {
+			return nil, err
+		}
+	} else {
+		return nil, err
+	}
+}
@@ -11,5 +11,8 @@ func RegisterDefaultTypes() {
 	platform.RegisterType("DistributedCache", CreateDistributedCacheBackend,
 		"local",
 		"kubernetes",
+		"coalesce",
+		"coalesceTimeout",
+		"relayEvents",
 	)
 }
@@ -24,7 +24,12 @@ import (
 //
 
 type DistributedCacheBackend struct {
+	Coalesce        bool
+	CoalesceTimeout time.Duration
+	RelayEvents     bool
+
 	local               platform.CacheBackend
+	flights             *platform.Flights // rendered by other nodes
 	cluster             *memberlist.Memberlist
 	queue               *memberlist.TransmitLimitedQueue
 	kubernetesConfig    *KubernetesConfig
@@ -32,7 +37,10 @@ type DistributedCacheBackend struct {
 }
 
 func NewDistributedCacheBackend() *DistributedCacheBackend {
-	return &DistributedCacheBackend{}
+	return &DistributedCacheBackend{
+		CoalesceTimeout: 10 * time.Second,
+		flights:         platform.NewFlights(),
+	}
 }
 
 // ([platform.CreateFunc] signature)
@@ -52,6 +60,13 @@ func CreateDistributedCacheBackend(jsContext *commonjs.Context, config ard.Strin
 		self.kubernetesConfig.Selector, _ = kubernetes_.Get("selector").String()
 	}
 
+	self.Coalesce, _ = config_.Get("coalesce").Boolean()
+	if coalesceTimeout, ok := config_.Get("coalesceTimeout").Float(); ok {
+		self.CoalesceTimeout = time.Duration(coalesceTimeout * float64(time.Second))
+	}
+
+	self.RelayEvents, _ = config_.Get("relayEvents").Boolean()
+
 	self.queue = &memberlist.TransmitLimitedQueue{
 		NumNodes:       self.numNodes,
 		RetransmitMult: 3,
@@ -93,6 +108,52 @@ func (self *DistributedCacheBackend) DeleteGroup(name platform.CacheKey) {
 	self.queue.QueueBroadcast(NewDeleteGroupMessage(name))
 }
 
+// ([platform.CacheCoalescer] interface)
+func (self *DistributedCacheBackend) JoinRendering(key platform.CacheKey) *platform.Flight {
+	if !self.Coalesce {
+		return nil
+	}
+
+	if flight, ok := self.flights.Get(key); ok {
+		return flight
+	}
+
+	self.queue.QueueBroadcast(NewRenderingMessage(key))
+	return nil
+}
+
+// ([platform.CacheCoalescer] interface)
+func (self *DistributedCacheBackend) LeaveRendering(key platform.CacheKey) {
+	if self.Coalesce {
+		self.queue.QueueBroadcast(NewRenderedMessage(key))
+	}
+}
+
+// ([platform.EventRelay] interface)
+func (self *DistributedCacheBackend) RelayEvent(event *platform.Event) {
+	if self.RelayEvents {
+		self.queue.QueueBroadcast(NewEventMessage(event))
+	}
+}
+
+// ([platform.CacheInspector] interface)
+func (self *DistributedCacheBackend) IterateEntries(iterate func(entry *platform.CacheEntry) bool) {
+	if cacheInspector, ok := self.local.(platform.CacheInspector); ok {
+		cacheInspector.IterateEntries(iterate)
+	}
+}
+
+// ([platform.CacheInspector] interface)
+func (self *DistributedCacheBackend) GetMetrics() map[string]any {
+	metrics := map[string]any{
+		"members": self.cluster.NumMembers(),
+	}
+	if cacheInspector, ok := self.local.(platform.CacheInspector); ok {
+		metrics["local"] = cacheInspector.GetMetrics()
+	}
+	return metrics
+}
+
 // ([platform.Startable] interface)
 func (self *DistributedCacheBackend) Start() error {
 	if self.kubernetesConfig != nil {
@@ -131,12 +192,26 @@ func (self *DistributedCacheBackend) NotifyMsg(bytes []byte) {
 		case StoreRepresentationMessageType:
 			log.Debugf("remote store: %s", message.Key)
 			self.local.StoreRepresentation(message.Key, message.Representation)
+			self.flights.Land(message.Key, message.Representation)
 		case DeleteRepresentationMessageType:
 			log.Debugf("remote delete: %s", message.Key)
 			self.local.DeleteRepresentation(message.Key)
 		case DeleteGroupMessageType:
 			log.Debugf("remote delete group: %s", message.Key)
 			self.local.DeleteGroup(message.Key)
+		case RenderingMessageType:
+			log.Debugf("remote rendering: %s", message.Key)
+			self.flights.Prune()
+			// The flight expires in case we never hear back from the node
+			self.flights.Join(message.Key, time.Now().Add(self.CoalesceTimeout))
+		case RenderedMessageType:
+			log.Debugf("remote rendered: %s", message.Key)
+			self.flights.Land(message.Key, nil)
+		case EventMessageType:
+			if message.Event != nil {
+				log.Debugf("remote event: %s", message.Event.Channel)
+				platform.DeliverEvent(message.Event)
+			}
 		}
 	}
 }
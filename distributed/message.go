@@ -12,6 +12,9 @@ const (
 	StoreRepresentationMessageType  = MessageType(1)
 	DeleteRepresentationMessageType = MessageType(2)
 	DeleteGroupMessageType          = MessageType(3)
+	RenderingMessageType            = MessageType(4)
+	RenderedMessageType             = MessageType(5)
+	EventMessageType                = MessageType(6)
 )
 
 //
@@ -22,6 +25,7 @@ type Message struct {
 	Type           MessageType
 	Key            platform.CacheKey
 	Representation *platform.CachedRepresentation
+	Event          *platform.Event
 }
 
 func NewStoreRepresentationMessage(key platform.CacheKey, cached *platform.CachedRepresentation) *Message {
@@ -46,6 +50,27 @@ func NewDeleteGroupMessage(name platform.CacheKey) *Message {
 	}
 }
 
+func NewRenderingMessage(key platform.CacheKey) *Message {
+	return &Message{
+		Type: RenderingMessageType,
+		Key:  key,
+	}
+}
+
+func NewRenderedMessage(key platform.CacheKey) *Message {
+	return &Message{
+		Type: RenderedMessageType,
+		Key:  key,
+	}
+}
+
+func NewEventMessage(event *platform.Event) *Message {
+	return &Message{
+		Type:  EventMessageType,
+		Event: event,
+	}
+}
+
 func ParseMessage(bytes []byte) *Message {
 	var self Message
 	if err := cbor.Unmarshal(bytes, &self); err == nil {
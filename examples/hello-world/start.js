@@ -43,6 +43,7 @@ prudence.schedule('1/10 * * * * *', function() {
 prudence.start([
     new prudence.Server({
         address: ':8080',
+        engine: prudence.arguments.engine, // "nethttp" (the default) or "fasthttp"
         handler: bind('./myapp/router', 'handler'),
         secure: (prudence.arguments.secure === 'true') ? {} : null, // an empty object will generate a self-signed certificate
         /* Full "secure" example:
@@ -7,11 +7,17 @@ import (
 
 	"github.com/dop251/goja"
 	"github.com/tliron/commonjs-goja"
+	"github.com/tliron/commonjs-goja/api"
 	"github.com/tliron/go-ard"
+	"github.com/tliron/prudence/client"
+	"github.com/tliron/prudence/disk"
 	"github.com/tliron/prudence/distributed"
 	"github.com/tliron/prudence/local"
 	"github.com/tliron/prudence/memory"
 	"github.com/tliron/prudence/platform"
+	"github.com/tliron/prudence/preencoding"
+	"github.com/tliron/prudence/purge"
+	"github.com/tliron/prudence/redis"
 	"github.com/tliron/prudence/rest"
 	"github.com/tliron/prudence/tiered"
 )
@@ -20,9 +26,14 @@ const DEFAULT_START_TIMEOUT_SECONDS = 10.0
 
 func init() {
 	rest.RegisterDefaultTypes()
+	client.RegisterDefaultTypes()
+	disk.RegisterDefaultTypes()
 	distributed.RegisterDefaultTypes()
 	local.RegisterDefaultTypes()
 	memory.RegisterDefaultTypes()
+	preencoding.RegisterDefaultTypes()
+	purge.RegisterDefaultTypes()
+	redis.RegisterDefaultTypes()
 	tiered.RegisterDefaultTypes()
 }
 
@@ -113,8 +124,65 @@ func (self *PrudenceAPI) InvalidateCache(key string) {
 }
 
 func (self *PrudenceAPI) InvalidateCacheGroup(group string) {
-	if cacheBackend := platform.GetCacheBackend(); cacheBackend != nil {
-		cacheBackend.DeleteGroup(platform.CacheKey(group))
+	platform.InvalidateCacheGroup(platform.CacheKey(group))
+}
+
+func (self *PrudenceAPI) SetCachePurgers(cachePurgers ...platform.CachePurger) {
+	platform.SetCachePurgers(cachePurgers...)
+}
+
+func (self *PrudenceAPI) AddCachePurger(cachePurger platform.CachePurger) {
+	platform.AddCachePurger(cachePurger)
+}
+
+// Data that is not a string will be encoded as JSON. Type and ID are optional.
+func (self *PrudenceAPI) PublishEvent(channel string, data any, type_ string, id string) error {
+	data_, ok := data.(string)
+	if !ok {
+		var transcriber api.Transcribe
+		var err error
+		if data_, err = transcriber.Stringify(data, "json", ""); err != nil {
+			return err
+		}
+	}
+
+	platform.PublishEvent(&platform.Event{
+		Channel: channel,
+		ID:      id,
+		Type:    type_,
+		Data:    data_,
+	})
+
+	return nil
+}
+
+// Sends to all WebSocket connections in the room.
+func (self *PrudenceAPI) Broadcast(room string, message any) {
+	rest.BroadcastWebSocket(room, message)
+}
+
+func (self *PrudenceAPI) GetCacheStats() *platform.CacheStats {
+	return platform.GetCacheStats()
+}
+
+func (self *PrudenceAPI) ResetCacheStats() {
+	platform.ResetCacheStats()
+}
+
+func (self *PrudenceAPI) ListCacheEntries(prefix string, group string, limit int) []*platform.CacheEntry {
+	return platform.ListCacheEntries(prefix, platform.CacheKey(group), limit)
+}
+
+func (self *PrudenceAPI) ListCacheGroups() map[platform.CacheKey][]platform.CacheKey {
+	return platform.ListCacheGroups()
+}
+
+// Creates a [rest.CacheWarmer] and runs it. Returns the number of requests sent.
+func (self *PrudenceAPI) WarmCache(config ard.StringMap) (int, error) {
+	if cacheWarmer, err := rest.CreateCacheWarmer(self.jsContext, config); err == nil {
+		return cacheWarmer.(*rest.CacheWarmer).Warm()
+	} else {
+		return 0, err
 	}
 }
 
@@ -130,6 +198,11 @@ func (self *PrudenceAPI) Schedule(cronPattern string, job func()) error {
 	}
 }
 
+// Sends an HTTP request with the default [client.HttpClient].
+func (self *PrudenceAPI) Fetch(url string, options ard.StringMap) (*client.FetchResponse, error) {
+	return client.Fetch(url, options)
+}
+
 // Utils
 
 func newTypeConstructor(jsContext *commonjs.Context, type_ *platform.Type) commonjs.JavaScriptConstructorFunc {
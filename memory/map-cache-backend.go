@@ -50,11 +50,11 @@ func CreateMapCacheBackend(jsContext *commonjs.Context, config ard.StringMap) (a
 func (self *MapCacheBackend) LoadRepresentation(key platform.CacheKey) (*platform.CachedRepresentation, bool) {
 	self.lock.RLock()
 	if cached, ok := self.representations[key]; ok {
-		if cached.Expired() {
+		if cached.Discardable() {
 			self.lock.RUnlock()
 			log.Debug("cache expired", "key", key, "encodings", cached.String())
 			self.lock.Lock()
-			if cached.Expired() {
+			if cached.Discardable() {
 				delete(self.representations, key)
 			}
 			self.lock.Unlock()
@@ -101,12 +101,36 @@ func (self *MapCacheBackend) DeleteGroup(name platform.CacheKey) {
 	}()
 }
 
+// ([platform.CacheInspector] interface)
+func (self *MapCacheBackend) IterateEntries(iterate func(entry *platform.CacheEntry) bool) {
+	self.lock.RLock()
+	defer self.lock.RUnlock()
+
+	for key, cached := range self.representations {
+		if !cached.Discardable() {
+			if !iterate(&platform.CacheEntry{
+				Key:        key,
+				Groups:     cached.Groups,
+				Size:       int64(cached.GetSize()),
+				Expiration: cached.Retention(),
+			}) {
+				return
+			}
+		}
+	}
+}
+
+// ([platform.CacheInspector] interface)
+func (self *MapCacheBackend) GetMetrics() map[string]any {
+	return nil
+}
+
 func (self *MapCacheBackend) Prune() {
 	self.lock.Lock()
 	defer self.lock.Unlock()
 
 	for key, cached := range self.representations {
-		if cached.Expired() {
+		if cached.Discardable() {
 			log.Debug("pruning representation", "key", key)
 			delete(self.representations, key)
 		}
@@ -138,8 +162,8 @@ func (self *MapCacheBackend) StopPruning() {
 // GetExpirationFunc signature
 func (self *MapCacheBackend) getExpiration(key platform.CacheKey) (time.Time, bool) {
 	if cached, ok := self.representations[key]; ok {
-		if !cached.Expired() {
-			return cached.Expiration, true
+		if !cached.Discardable() {
+			return cached.Retention(), true
 		} else {
 			return time.Time{}, false
 		}
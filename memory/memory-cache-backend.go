@@ -23,12 +23,22 @@ type MemoryCacheBackend struct {
 	groups  CacheGroups
 	lock    sync.RWMutex
 	pruning chan struct{}
+
+	// Ristretto cannot iterate its entries, so we keep our own index
+	index     map[*platform.CachedRepresentation]*indexEntry
+	indexLock sync.Mutex
+}
+
+type indexEntry struct {
+	key    platform.CacheKey
+	stored int // the same representation can be stored more than once
 }
 
 func NewMemoryCacheBackend() *MemoryCacheBackend {
 	return &MemoryCacheBackend{
 		groups:  make(CacheGroups),
 		pruning: make(chan struct{}),
+		index:   make(map[*platform.CachedRepresentation]*indexEntry),
 	}
 }
 
@@ -57,6 +67,8 @@ func CreateMemoryCacheBackend(jsContext *commonjs.Context, config ard.StringMap)
 		// Recommendations:
 		BufferItems: 64,
 		NumCounters: 100 * (maxSize / averageSize),
+		Metrics:     true,
+		OnExit:      self.onExit,
 	}
 
 	var err error
@@ -81,7 +93,20 @@ func (self *MemoryCacheBackend) LoadRepresentation(key platform.CacheKey) (*plat
 
 // ([platform.CacheBackend] interface)
 func (self *MemoryCacheBackend) StoreRepresentation(key platform.CacheKey, cached *platform.CachedRepresentation) {
-	self.cache.SetWithTTL(string(key), cached, int64(cached.GetSize()), cached.Expiration.Sub(time.Now()))
+	// Index before setting, because the value might exit right away
+	self.indexLock.Lock()
+	if entry, ok := self.index[cached]; ok {
+		entry.stored++
+	} else {
+		self.index[cached] = &indexEntry{key, 1}
+	}
+	self.indexLock.Unlock()
+
+	if !self.cache.SetWithTTL(string(key), cached, int64(cached.GetSize()), time.Until(cached.Retention())) {
+		// Dropped
+		self.onExit(cached)
+		return
+	}
 
 	if len(cached.Groups) > 0 {
 		go func() {
@@ -108,6 +133,48 @@ func (self *MemoryCacheBackend) DeleteGroup(name platform.CacheKey) {
 	}()
 }
 
+// ([platform.CacheInspector] interface)
+func (self *MemoryCacheBackend) IterateEntries(iterate func(entry *platform.CacheEntry) bool) {
+	self.indexLock.Lock()
+	entries := make([]*platform.CacheEntry, 0, len(self.index))
+	for cached, entry := range self.index {
+		if !cached.Discardable() {
+			entries = append(entries, &platform.CacheEntry{
+				Key:        entry.key,
+				Groups:     cached.Groups,
+				Size:       int64(cached.GetSize()),
+				Expiration: cached.Retention(),
+			})
+		}
+	}
+	self.indexLock.Unlock()
+
+	for _, entry := range entries {
+		if !iterate(entry) {
+			return
+		}
+	}
+}
+
+// ([platform.CacheInspector] interface)
+func (self *MemoryCacheBackend) GetMetrics() map[string]any {
+	metrics := self.cache.Metrics
+	return map[string]any{
+		"hits":         metrics.Hits(),
+		"misses":       metrics.Misses(),
+		"ratio":        metrics.Ratio(),
+		"keysAdded":    metrics.KeysAdded(),
+		"keysUpdated":  metrics.KeysUpdated(),
+		"keysEvicted":  metrics.KeysEvicted(),
+		"costAdded":    metrics.CostAdded(),
+		"costEvicted":  metrics.CostEvicted(),
+		"setsDropped":  metrics.SetsDropped(),
+		"setsRejected": metrics.SetsRejected(),
+		"getsDropped":  metrics.GetsDropped(),
+		"getsKept":     metrics.GetsKept(),
+	}
+}
+
 func (self *MemoryCacheBackend) Prune() {
 	self.lock.Lock()
 	defer self.lock.Unlock()
@@ -139,8 +206,8 @@ func (self *MemoryCacheBackend) StopPruning() {
 func (self *MemoryCacheBackend) getExpiration(key platform.CacheKey) (time.Time, bool) {
 	if cached, ok := self.cache.Get(string(key)); ok {
 		cached_ := cached.(*platform.CachedRepresentation)
-		if !cached_.Expired() {
-			return cached_.Expiration, true
+		if !cached_.Discardable() {
+			return cached_.Retention(), true
 		} else {
 			return time.Time{}, false
 		}
@@ -148,3 +215,16 @@ func (self *MemoryCacheBackend) getExpiration(key platform.CacheKey) (time.Time,
 		return time.Time{}, false
 	}
 }
+
+// ([ristretto.Config.OnExit] signature)
+func (self *MemoryCacheBackend) onExit(value any) {
+	if cached, ok := value.(*platform.CachedRepresentation); ok {
+		self.indexLock.Lock()
+		if entry, ok := self.index[cached]; ok {
+			if entry.stored--; entry.stored <= 0 {
+				delete(self.index, cached)
+			}
+		}
+		self.indexLock.Unlock()
+	}
+}
@@ -24,3 +24,20 @@ func SetCacheBackend(cacheBackend_ CacheBackend) {
 func GetCacheBackend() CacheBackend {
 	return cacheBackend
 }
+
+//
+// CacheCoalescer
+//
+
+// Optional interface for cache backends that can coordinate rendering across a
+// cluster so that only one node renders a missing representation at a time.
+type CacheCoalescer interface {
+	// If another node is rendering the representation returns its flight.
+	// Otherwise announces that we are rendering it and returns nil, in which
+	// case the caller must call LeaveRendering when done.
+	JoinRendering(key CacheKey) *Flight
+
+	// Announces that we are done rendering, whether or not we stored the
+	// representation.
+	LeaveRendering(key CacheKey)
+}
@@ -0,0 +1,89 @@
+package platform
+
+import (
+	"sort"
+	"strings"
+	"time"
+)
+
+//
+// CacheEntry
+//
+
+type CacheEntry struct {
+	Key        CacheKey   `json:"key"`
+	Groups     []CacheKey `json:"groups,omitempty"`
+	Size       int64      `json:"size"`
+	Expiration time.Time  `json:"expiration"` // when the backend will discard it
+}
+
+//
+// CacheInspector
+//
+
+// Optional interface for cache backends that can list their contents.
+type CacheInspector interface {
+	// Calls the function for each entry until it returns false. Might not be
+	// a consistent snapshot.
+	IterateEntries(iterate func(entry *CacheEntry) bool)
+
+	// Backend-specific metrics (can be nil).
+	GetMetrics() map[string]any
+}
+
+// If group is not empty will only list entries in that group. Entries are
+// sorted by key. If limit is 0 will list all entries, otherwise the first
+// entries (in sorted order) up to the limit.
+func ListCacheEntries(prefix string, group CacheKey, limit int) []*CacheEntry {
+	entries := make([]*CacheEntry, 0)
+
+	if cacheInspector, ok := GetCacheBackend().(CacheInspector); ok {
+		cacheInspector.IterateEntries(func(entry *CacheEntry) bool {
+			if (prefix != "") && !strings.HasPrefix(string(entry.Key), prefix) {
+				return true
+			}
+
+			if (group != "") && !containsCacheKey(entry.Groups, group) {
+				return true
+			}
+
+			entries = append(entries, entry)
+			return true
+		})
+	}
+
+	sort.Slice(entries, func(i int, j int) bool {
+		return entries[i].Key < entries[j].Key
+	})
+
+	if (limit > 0) && (len(entries) > limit) {
+		entries = entries[:limit]
+	}
+
+	return entries
+}
+
+// Maps group names to the keys of their entries.
+func ListCacheGroups() map[CacheKey][]CacheKey {
+	groups := make(map[CacheKey][]CacheKey)
+
+	if cacheInspector, ok := GetCacheBackend().(CacheInspector); ok {
+		cacheInspector.IterateEntries(func(entry *CacheEntry) bool {
+			for _, group := range entry.Groups {
+				groups[group] = append(groups[group], entry.Key)
+			}
+			return true
+		})
+	}
+
+	return groups
+}
+
+func containsCacheKey(keys []CacheKey, key CacheKey) bool {
+	for _, key_ := range keys {
+		if key_ == key {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,55 @@
+package platform
+
+import (
+	"sync"
+)
+
+var cachePurgers []CachePurger
+var cachePurgersLock sync.Mutex
+
+//
+// CachePurger
+//
+
+// Purges cache groups from caches outside of Prudence, such as CDNs and
+// reverse proxies. Cache groups are emitted to these caches as surrogate keys.
+type CachePurger interface {
+	PurgeGroups(names []CacheKey) error // sync
+}
+
+func SetCachePurgers(cachePurgers_ ...CachePurger) {
+	cachePurgersLock.Lock()
+	defer cachePurgersLock.Unlock()
+
+	cachePurgers = cachePurgers_
+}
+
+func AddCachePurger(cachePurger CachePurger) {
+	cachePurgersLock.Lock()
+	defer cachePurgersLock.Unlock()
+
+	cachePurgers = append(cachePurgers, cachePurger)
+}
+
+func GetCachePurgers() []CachePurger {
+	cachePurgersLock.Lock()
+	defer cachePurgersLock.Unlock()
+
+	return cachePurgers
+}
+
+// Deletes the group from the cache backend and purges it from all cache
+// purgers. Purging is async; errors are logged.
+func InvalidateCacheGroup(name CacheKey) {
+	if cacheBackend := GetCacheBackend(); cacheBackend != nil {
+		cacheBackend.DeleteGroup(name)
+	}
+
+	for _, cachePurger := range GetCachePurgers() {
+		go func(cachePurger CachePurger) {
+			if err := cachePurger.PurgeGroups([]CacheKey{name}); err != nil {
+				log.Errorf("could not purge cache group %q: %s", name, err.Error())
+			}
+		}(cachePurger)
+	}
+}
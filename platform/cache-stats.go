@@ -0,0 +1,172 @@
+package platform
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+var cacheCounters_ = newCacheCounters()
+
+//
+// CacheStats
+//
+
+type CacheStats struct {
+	Entries  int64                         `json:"entries"`
+	Size     int64                         `json:"size"`
+	Hits     uint64                        `json:"hits"`
+	Misses   uint64                        `json:"misses"`
+	Stores   uint64                        `json:"stores"`
+	HitRatio float64                       `json:"hitRatio"`
+	Groups   map[CacheKey]*CacheGroupStats `json:"groups"`
+	Backend  map[string]any                `json:"backend,omitempty"` // from CacheInspector.GetMetrics
+}
+
+//
+// CacheGroupStats
+//
+
+// Misses cannot be attributed to groups (we don't know the groups of a
+// representation we don't have), so we use stores instead, which follow most
+// misses.
+type CacheGroupStats struct {
+	Entries  int64   `json:"entries"`
+	Size     int64   `json:"size"`
+	Hits     uint64  `json:"hits"`
+	Stores   uint64  `json:"stores"`
+	HitRatio float64 `json:"hitRatio"`
+}
+
+// Hits, misses, and stores are counted since startup (or the last call to
+// [ResetCacheStats]). Entries and size are only available if the cache
+// backend is a [CacheInspector].
+func GetCacheStats() *CacheStats {
+	self := CacheStats{
+		Hits:   cacheCounters_.hits.Load(),
+		Misses: cacheCounters_.misses.Load(),
+		Stores: cacheCounters_.stores.Load(),
+		Groups: make(map[CacheKey]*CacheGroupStats),
+	}
+
+	self.HitRatio = ratio(self.Hits, self.Misses)
+
+	getGroup := func(name CacheKey) *CacheGroupStats {
+		if group, ok := self.Groups[name]; ok {
+			return group
+		}
+		group := new(CacheGroupStats)
+		self.Groups[name] = group
+		return group
+	}
+
+	cacheCounters_.lock.Lock()
+	for name, counters := range cacheCounters_.groups {
+		group := getGroup(name)
+		group.Hits = counters.hits
+		group.Stores = counters.stores
+	}
+	cacheCounters_.lock.Unlock()
+
+	if cacheInspector, ok := GetCacheBackend().(CacheInspector); ok {
+		cacheInspector.IterateEntries(func(entry *CacheEntry) bool {
+			self.Entries++
+			self.Size += entry.Size
+			for _, name := range entry.Groups {
+				group := getGroup(name)
+				group.Entries++
+				group.Size += entry.Size
+			}
+			return true
+		})
+
+		self.Backend = cacheInspector.GetMetrics()
+	}
+
+	for _, group := range self.Groups {
+		group.HitRatio = ratio(group.Hits, group.Stores)
+	}
+
+	return &self
+}
+
+func ResetCacheStats() {
+	cacheCounters_.reset()
+}
+
+func CountCacheHit(groups []CacheKey) {
+	cacheCounters_.hits.Add(1)
+	cacheCounters_.countGroups(groups, true)
+}
+
+func CountCacheMiss() {
+	cacheCounters_.misses.Add(1)
+}
+
+func CountCacheStore(groups []CacheKey) {
+	cacheCounters_.stores.Add(1)
+	cacheCounters_.countGroups(groups, false)
+}
+
+func ratio(hits uint64, misses uint64) float64 {
+	if total := hits + misses; total > 0 {
+		return float64(hits) / float64(total)
+	} else {
+		return 0.0
+	}
+}
+
+//
+// cacheCounters
+//
+
+type cacheCounters struct {
+	hits   atomic.Uint64
+	misses atomic.Uint64
+	stores atomic.Uint64
+	groups map[CacheKey]*cacheGroupCounters
+	lock   sync.Mutex
+}
+
+type cacheGroupCounters struct {
+	hits   uint64
+	stores uint64
+}
+
+func newCacheCounters() *cacheCounters {
+	return &cacheCounters{
+		groups: make(map[CacheKey]*cacheGroupCounters),
+	}
+}
+
+func (self *cacheCounters) countGroups(groups []CacheKey, hit bool) {
+	if len(groups) == 0 {
+		return
+	}
+
+	self.lock.Lock()
+	defer self.lock.Unlock()
+
+	for _, name := range groups {
+		counters, ok := self.groups[name]
+		if !ok {
+			counters = new(cacheGroupCounters)
+			self.groups[name] = counters
+		}
+
+		if hit {
+			counters.hits++
+		} else {
+			counters.stores++
+		}
+	}
+}
+
+func (self *cacheCounters) reset() {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+
+	self.hits.Store(0)
+	self.misses.Store(0)
+	self.stores.Store(0)
+	self.groups = make(map[CacheKey]*cacheGroupCounters)
+}
@@ -14,6 +14,11 @@ type CachedRepresentation struct {
 	Headers    map[string][]string
 	Body       map[EncodingType][]byte
 	Expiration time.Time
+
+	// Extra time after expiration during which the representation may still be
+	// used. See RFC 5861.
+	StaleWhileRevalidate time.Duration
+	StaleIfError         time.Duration
 }
 
 // ([fmt.Stringer] interface)
@@ -31,6 +36,33 @@ func (self *CachedRepresentation) Expired() bool {
 	return time.Now().After(self.Expiration)
 }
 
+// True if expired but can still be used while a fresh representation is
+// generated in the background.
+func (self *CachedRepresentation) CanRevalidate() bool {
+	return time.Now().Before(self.Expiration.Add(self.StaleWhileRevalidate))
+}
+
+// True if expired but can still be used if generating a fresh representation
+// fails.
+func (self *CachedRepresentation) CanServeOnError() bool {
+	return time.Now().Before(self.Expiration.Add(self.StaleIfError))
+}
+
+// Until when cache backends should keep the representation. This is later
+// than Expiration if stale use is allowed.
+func (self *CachedRepresentation) Retention() time.Time {
+	stale := self.StaleWhileRevalidate
+	if self.StaleIfError > stale {
+		stale = self.StaleIfError
+	}
+	return self.Expiration.Add(stale)
+}
+
+// True if cache backends should discard the representation.
+func (self *CachedRepresentation) Discardable() bool {
+	return time.Now().After(self.Retention())
+}
+
 // In seconds
 func (self *CachedRepresentation) TimeToLive() float64 {
 	duration := self.Expiration.Sub(time.Now()).Seconds()
@@ -40,35 +72,51 @@ func (self *CachedRepresentation) TimeToLive() float64 {
 	return duration
 }
 
+// Shallow copy, but with its own body map, so that reencoding the body (see
+// [CachedRepresentation.ReencodeBody]) will not modify the original.
+func (self *CachedRepresentation) Copy() *CachedRepresentation {
+	copy_ := *self
+	copy_.Body = make(map[EncodingType][]byte, len(self.Body))
+	for encoding, body := range self.Body {
+		copy_.Body[encoding] = body
+	}
+	return &copy_
+}
+
 func (self *CachedRepresentation) GetBody(encoding EncodingType) ([]byte, bool) {
+	return self.GetBodyLevel(encoding, DefaultEncodingLevel)
+}
+
+// Level is used if we need to reencode.
+func (self *CachedRepresentation) GetBodyLevel(encoding EncodingType, level int) ([]byte, bool) {
 	if body, ok := self.Body[encoding]; ok {
 		return body, false
 	}
 
 	// Try to reencode from other encodings (in order of decoding performance)
-	if body, ok := self.ReencodeBody(EncodingTypeIdentity, encoding); ok {
+	if body, ok := self.ReencodeBody(EncodingTypeIdentity, encoding, level); ok {
 		return body, true
 	}
-	if body, ok := self.ReencodeBody(EncodingTypeZstandard, encoding); ok {
+	if body, ok := self.ReencodeBody(EncodingTypeZstandard, encoding, level); ok {
 		return body, true
 	}
-	if body, ok := self.ReencodeBody(EncodingTypeGZip, encoding); ok {
+	if body, ok := self.ReencodeBody(EncodingTypeGZip, encoding, level); ok {
 		return body, true
 	}
-	if body, ok := self.ReencodeBody(EncodingTypeDeflate, encoding); ok {
+	if body, ok := self.ReencodeBody(EncodingTypeDeflate, encoding, level); ok {
 		return body, true
 	}
-	if body, ok := self.ReencodeBody(EncodingTypeBrotli, encoding); ok {
+	if body, ok := self.ReencodeBody(EncodingTypeBrotli, encoding, level); ok {
 		return body, true
 	}
 
 	return nil, false
 }
 
-func (self *CachedRepresentation) ReencodeBody(fromEncoding EncodingType, toEncoding EncodingType) ([]byte, bool) {
+func (self *CachedRepresentation) ReencodeBody(fromEncoding EncodingType, toEncoding EncodingType, level int) ([]byte, bool) {
 	if fromEncoding != toEncoding {
 		if decodedBody, ok := self.DecodeBody(fromEncoding); ok {
-			if reencodedBody, err := toEncoding.Encoded(decodedBody); err == nil {
+			if reencodedBody, err := toEncoding.EncodedLevel(decodedBody, level); err == nil {
 				self.Body[toEncoding] = reencodedBody
 				return reencodedBody, true
 			} else {
@@ -10,13 +10,20 @@ import (
 //
 
 type EncodeWriter struct {
+	Level int
+
+	// Called on Close. If it returns false the body will be written as is.
+	ShouldEncode func(body []byte) bool
+
 	encoding EncodingType
 	writer   io.Writer
 	buffer   *bytes.Buffer
+	stream   *StreamEncodeWriter // after Flush
 }
 
 func (self EncodingType) NewWriter(writer io.Writer) *EncodeWriter {
 	return &EncodeWriter{
+		Level:    DefaultEncodingLevel,
 		encoding: self,
 		writer:   writer,
 		buffer:   bytes.NewBuffer(nil),
@@ -25,22 +32,57 @@ func (self EncodingType) NewWriter(writer io.Writer) *EncodeWriter {
 
 // ([io.Writer] interface)
 func (self *EncodeWriter) Write(b []byte) (int, error) {
+	if self.stream != nil {
+		return self.stream.Write(b)
+	}
 	return self.buffer.Write(b)
 }
 
 // [io.StringWriter] interface
 func (self *EncodeWriter) WriteString(s string) (int, error) {
+	if self.stream != nil {
+		return self.stream.WriteString(s)
+	}
 	return self.buffer.WriteString(s)
 }
 
 // [io.ByteWriter] interface
 func (self *EncodeWriter) WriteByte(c byte) error {
+	if self.stream != nil {
+		return self.stream.WriteByte(c)
+	}
 	return self.buffer.WriteByte(c)
 }
 
+// Switches to encoding while writing (see [StreamEncodeWriter]) and writes
+// everything encoded so far to the wrapped writer. ShouldEncode will be called
+// right away with what was written until now.
+func (self *EncodeWriter) Flush() error {
+	if self.stream == nil {
+		self.stream = self.encoding.NewStreamWriter(self.writer)
+		self.stream.Level = self.Level
+		self.stream.ShouldEncode = self.ShouldEncode
+		if _, err := self.stream.Write(self.buffer.Bytes()); err != nil {
+			return err
+		}
+		self.buffer = nil
+	}
+
+	return self.stream.Flush()
+}
+
 // ([io.Closer] interface)
 func (self *EncodeWriter) Close() error {
-	return self.encoding.Encode(self.buffer.Bytes(), self.writer)
+	if self.stream != nil {
+		return self.stream.Close()
+	}
+
+	body := self.buffer.Bytes()
+	if (self.ShouldEncode != nil) && !self.ShouldEncode(body) {
+		_, err := self.writer.Write(body)
+		return err
+	}
+	return self.encoding.EncodeLevel(body, self.writer, self.Level)
 }
 
 // ([jst.WrappingWriter] interface)
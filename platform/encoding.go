@@ -12,6 +12,8 @@ import (
 	"github.com/tliron/commonlog"
 )
 
+const DefaultEncodingLevel = -1
+
 //
 // EncodingType
 //
@@ -86,20 +88,50 @@ func GetEncodingFromHeader(name string) EncodingType {
 }
 
 func (self EncodingType) Encode(bytes []byte, writer io.Writer) error {
+	return self.EncodeLevel(bytes, writer, DefaultEncodingLevel)
+}
+
+// The meaning of level depends on the encoding. Use [DefaultEncodingLevel] for
+// the library default.
+func (self EncodingType) EncodeLevel(bytes []byte, writer io.Writer, level int) error {
 	switch self {
 	case EncodingTypeBrotli:
-		return EncodeBrotli(bytes, writer)
+		return EncodeBrotli(bytes, writer, level)
 	case EncodingTypeDeflate:
-		return EncodeDeflate(bytes, writer)
+		return EncodeDeflate(bytes, writer, level)
 	case EncodingTypeGZip:
-		return EncodeGZip(bytes, writer)
+		return EncodeGZip(bytes, writer, level)
 	case EncodingTypeZstandard:
-		return EncodeZstandard(bytes, writer)
+		return EncodeZstandard(bytes, writer, level)
 	default:
 		return fmt.Errorf("unsupported encoding: %d", self)
 	}
 }
 
+// Returns a writer that encodes into the writer as it is written to. Must be
+// closed to complete the encoding.
+func (self EncodingType) NewEncoder(writer io.Writer, level int) (io.WriteCloser, error) {
+	switch self {
+	case EncodingTypeBrotli:
+		if level == DefaultEncodingLevel {
+			level = brotli.DefaultCompression
+		}
+		return brotli.NewWriterLevel(writer, level), nil
+	case EncodingTypeDeflate:
+		return zlib.NewWriterLevel(writer, level)
+	case EncodingTypeGZip:
+		return pgzip.NewWriterLevel(writer, level)
+	case EncodingTypeZstandard:
+		var options []zstd.EOption
+		if level > 0 {
+			options = append(options, zstd.WithEncoderLevel(zstd.EncoderLevelFromZstd(level)))
+		}
+		return zstd.NewWriter(writer, options...)
+	default:
+		return nil, fmt.Errorf("unsupported encoding: %d", self)
+	}
+}
+
 func (self EncodingType) Decode(bytes []byte, writer io.Writer) error {
 	switch self {
 	case EncodingTypeBrotli:
@@ -116,12 +148,16 @@ func (self EncodingType) Decode(bytes []byte, writer io.Writer) error {
 }
 
 func (self EncodingType) Encoded(bytes []byte) ([]byte, error) {
+	return self.EncodedLevel(bytes, DefaultEncodingLevel)
+}
+
+func (self EncodingType) EncodedLevel(bytes []byte, level int) ([]byte, error) {
 	if self == EncodingTypeIdentity {
 		return bytes, nil
 	}
 
 	buffer := bytespkg.NewBuffer(nil)
-	if err := self.Encode(bytes, buffer); err == nil {
+	if err := self.EncodeLevel(bytes, buffer, level); err == nil {
 		return buffer.Bytes(), nil
 	} else {
 		return nil, err
@@ -141,8 +177,12 @@ func (self EncodingType) Decoded(bytes []byte) ([]byte, error) {
 	}
 }
 
-func EncodeBrotli(bytes []byte, writer io.Writer) error {
-	writer_ := brotli.NewWriter(writer)
+// Level is 0 (fastest) to 11 (best).
+func EncodeBrotli(bytes []byte, writer io.Writer, level int) error {
+	if level == DefaultEncodingLevel {
+		level = brotli.DefaultCompression
+	}
+	writer_ := brotli.NewWriterLevel(writer, level)
 	defer commonlog.CallAndLogWarning(writer_.Close, "EncodeBrotli.Close", log)
 	_, err := writer_.Write(bytes)
 	return err
@@ -154,10 +194,14 @@ func DecodeBrotli(bytes []byte, writer io.Writer) error {
 	return err
 }
 
-func EncodeDeflate(bytes []byte, writer io.Writer) error {
-	writer_ := zlib.NewWriter(writer)
+// Level is 0 (none) to 9 (best).
+func EncodeDeflate(bytes []byte, writer io.Writer, level int) error {
+	writer_, err := zlib.NewWriterLevel(writer, level)
+	if err != nil {
+		return err
+	}
 	defer commonlog.CallAndLogWarning(writer_.Close, "EncodeDeflate.Close", log)
-	_, err := writer_.Write(bytes)
+	_, err = writer_.Write(bytes)
 	return err
 }
 
@@ -170,10 +214,14 @@ func DecodeDeflate(bytes []byte, writer io.Writer) error {
 	}
 }
 
-func EncodeGZip(bytes []byte, writer io.Writer) error {
-	writer_ := pgzip.NewWriter(writer)
+// Level is 0 (none) to 9 (best).
+func EncodeGZip(bytes []byte, writer io.Writer, level int) error {
+	writer_, err := pgzip.NewWriterLevel(writer, level)
+	if err != nil {
+		return err
+	}
 	defer commonlog.CallAndLogWarning(writer_.Close, "EncodeGZip.Close", log)
-	_, err := writer_.Write(bytes)
+	_, err = writer_.Write(bytes)
 	return err
 }
 
@@ -186,8 +234,13 @@ func DecodeGZip(bytes []byte, writer io.Writer) error {
 	}
 }
 
-func EncodeZstandard(bytes []byte, writer io.Writer) error {
-	if writer_, err := zstd.NewWriter(writer); err == nil {
+// Level is 1 (fastest) to 22 (best), as in the zstd command line tool.
+func EncodeZstandard(bytes []byte, writer io.Writer, level int) error {
+	var options []zstd.EOption
+	if level > 0 {
+		options = append(options, zstd.WithEncoderLevel(zstd.EncoderLevelFromZstd(level)))
+	}
+	if writer_, err := zstd.NewWriter(writer, options...); err == nil {
 		defer commonlog.CallAndLogWarning(writer_.Close, "EncodeZstandard.Close", log)
 		_, err := writer_.Write(bytes)
 		return err
@@ -204,3 +257,17 @@ func DecodeZstandard(bytes []byte, writer io.Writer) error {
 		return err
 	}
 }
+
+//
+// EncodingLevels
+//
+
+type EncodingLevels map[EncodingType]int
+
+func (self EncodingLevels) Get(encoding EncodingType) int {
+	if level, ok := self[encoding]; ok {
+		return level
+	} else {
+		return DefaultEncodingLevel
+	}
+}
@@ -0,0 +1,281 @@
+package platform
+
+import (
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	DEFAULT_EVENT_HISTORY     = 100
+	DEFAULT_EVENT_HISTORY_AGE = 5 * time.Minute
+)
+
+var eventBroker = NewEventBroker(DEFAULT_EVENT_HISTORY, DEFAULT_EVENT_HISTORY_AGE)
+
+// Publishes the event to all subscribers of its channel, including on other
+// nodes if the cache backend is an [EventRelay]. Assigns an ID if it doesn't
+// have one.
+func PublishEvent(event *Event) {
+	if event.ID == "" {
+		event.ID = newEventId()
+	}
+
+	eventBroker.Deliver(event)
+
+	if eventRelay, ok := GetCacheBackend().(EventRelay); ok {
+		eventRelay.RelayEvent(event)
+	}
+}
+
+// Publishes the event to local subscribers only. For use by an [EventRelay]
+// when receiving events from other nodes.
+func DeliverEvent(event *Event) {
+	eventBroker.Deliver(event)
+}
+
+// See [EventBroker.Subscribe].
+func SubscribeEvents(channel string, lastEventId string, size int) (*EventSubscription, []*Event) {
+	return eventBroker.Subscribe(channel, lastEventId, size)
+}
+
+func SetEventHistory(history int) {
+	eventBroker.SetHistory(history)
+}
+
+func SetEventHistoryAge(age time.Duration) {
+	eventBroker.SetHistoryAge(age)
+}
+
+var lastEventId atomic.Int64
+
+// Unique and increasing per node.
+func newEventId() string {
+	for {
+		last := lastEventId.Load()
+		id := time.Now().UnixNano()
+		if id <= last {
+			id = last + 1
+		}
+		if lastEventId.CompareAndSwap(last, id) {
+			return strconv.FormatInt(id, 36)
+		}
+	}
+}
+
+//
+// Event
+//
+
+type Event struct {
+	Channel string
+	ID      string
+	Type    string // empty for the default ("message")
+	Data    string
+}
+
+//
+// EventRelay
+//
+
+// Optional interface for cache backends that can relay published events to
+// other nodes in the cluster, which should call [DeliverEvent].
+type EventRelay interface {
+	RelayEvent(event *Event)
+}
+
+//
+// EventSubscription
+//
+
+type EventSubscription struct {
+	Channel string
+	Events  chan *Event // closed when unsubscribed
+
+	broker *EventBroker
+}
+
+func (self *EventSubscription) Unsubscribe() {
+	self.broker.Unsubscribe(self)
+}
+
+//
+// EventBroker
+//
+
+// Channels are created on demand and removed once they have no subscribers
+// and no history. Because events older than the history age are discarded,
+// channels that are no longer used are eventually removed.
+type EventBroker struct {
+	history    int
+	historyAge time.Duration
+	channels   map[string]*eventChannel
+	nextPrune  time.Time
+	lock       sync.Mutex
+}
+
+type eventChannel struct {
+	subscriptions map[*EventSubscription]struct{}
+	history       []historicEvent // oldest first
+}
+
+type historicEvent struct {
+	event     *Event
+	delivered time.Time
+}
+
+func NewEventBroker(history int, historyAge time.Duration) *EventBroker {
+	return &EventBroker{
+		history:    history,
+		historyAge: historyAge,
+		channels:   make(map[string]*eventChannel),
+	}
+}
+
+// Maximum number of events kept per channel for resumption.
+func (self *EventBroker) SetHistory(history int) {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+
+	self.history = history
+	for _, channel := range self.channels {
+		channel.trim(history)
+	}
+}
+
+// Events older than this are discarded from the history. Note that the
+// history is pruned lazily, so events might be kept for up to twice as long.
+func (self *EventBroker) SetHistoryAge(age time.Duration) {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+
+	self.historyAge = age
+	self.nextPrune = time.Time{}
+	self.prune(time.Now())
+}
+
+// Also returns the events published after lastEventId (if we have it in the
+// history). Size is the number of events that can be waiting for the
+// subscriber. If it is exceeded the subscription will be closed.
+func (self *EventBroker) Subscribe(channel string, lastEventId string, size int) (*EventSubscription, []*Event) {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+
+	self.prune(time.Now())
+
+	channel_, ok := self.channels[channel]
+	if !ok {
+		channel_ = &eventChannel{subscriptions: make(map[*EventSubscription]struct{})}
+		self.channels[channel] = channel_
+	}
+
+	subscription := EventSubscription{
+		Channel: channel,
+		Events:  make(chan *Event, size),
+		broker:  self,
+	}
+	channel_.subscriptions[&subscription] = struct{}{}
+
+	var missed []*Event
+	if lastEventId != "" {
+		for index, historic := range channel_.history {
+			if historic.event.ID == lastEventId {
+				for _, historic := range channel_.history[index+1:] {
+					missed = append(missed, historic.event)
+				}
+				break
+			}
+		}
+	}
+
+	return &subscription, missed
+}
+
+func (self *EventBroker) Unsubscribe(subscription *EventSubscription) {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+
+	self.unsubscribe(subscription)
+}
+
+func (self *EventBroker) Deliver(event *Event) {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+
+	now := time.Now()
+	self.prune(now)
+
+	channel, ok := self.channels[event.Channel]
+	if !ok {
+		if (self.history == 0) || (self.historyAge == 0) {
+			return
+		}
+		channel = &eventChannel{subscriptions: make(map[*EventSubscription]struct{})}
+		self.channels[event.Channel] = channel
+	}
+
+	if (self.history > 0) && (self.historyAge > 0) {
+		channel.history = append(channel.history, historicEvent{event, now})
+		channel.trim(self.history)
+	}
+
+	for subscription := range channel.subscriptions {
+		select {
+		case subscription.Events <- event:
+		default:
+			// Too slow; the client can reconnect and resume from the history
+			log.Warningf("event subscriber is too slow, closing: %s", event.Channel)
+			self.unsubscribe(subscription)
+		}
+	}
+}
+
+// Call with lock
+func (self *EventBroker) unsubscribe(subscription *EventSubscription) {
+	if channel, ok := self.channels[subscription.Channel]; ok {
+		if _, ok := channel.subscriptions[subscription]; ok {
+			delete(channel.subscriptions, subscription)
+			close(subscription.Events)
+		}
+
+		if (len(channel.subscriptions) == 0) && (len(channel.history) == 0) {
+			delete(self.channels, subscription.Channel)
+		}
+	}
+}
+
+// Call with lock
+func (self *EventBroker) prune(now time.Time) {
+	if now.Before(self.nextPrune) {
+		return
+	}
+	self.nextPrune = now.Add(self.historyAge)
+
+	expiration := now.Add(-self.historyAge)
+	for name, channel := range self.channels {
+		channel.expire(expiration)
+		if (len(channel.subscriptions) == 0) && (len(channel.history) == 0) {
+			delete(self.channels, name)
+		}
+	}
+}
+
+func (self *eventChannel) trim(history int) {
+	if excess := len(self.history) - history; excess > 0 {
+		self.history = append([]historicEvent(nil), self.history[excess:]...)
+	}
+}
+
+// Discards events delivered before the expiration.
+func (self *eventChannel) expire(expiration time.Time) {
+	for index, historic := range self.history {
+		if historic.delivered.After(expiration) {
+			if index > 0 {
+				self.history = append([]historicEvent(nil), self.history[index:]...)
+			}
+			return
+		}
+	}
+	self.history = nil
+}
@@ -0,0 +1,116 @@
+package platform
+
+import (
+	contextpkg "context"
+	"sync"
+	"time"
+)
+
+//
+// Flight
+//
+// A representation that is currently being rendered. Others can wait for it
+// to land instead of rendering it themselves.
+//
+
+type Flight struct {
+	Expiration time.Time // zero for never
+
+	cached *CachedRepresentation
+	done   chan struct{}
+}
+
+func NewFlight(expiration time.Time) *Flight {
+	return &Flight{
+		Expiration: expiration,
+		done:       make(chan struct{}),
+	}
+}
+
+// Waits until the flight lands, the context is done, or the timeout passes.
+// The returned representation may be nil if the renderer did not store one.
+func (self *Flight) Wait(context contextpkg.Context, timeout time.Duration) (*CachedRepresentation, bool) {
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	select {
+	case <-self.done:
+		return self.cached, true
+	case <-context.Done():
+		return nil, false
+	case <-timer.C:
+		return nil, false
+	}
+}
+
+func (self *Flight) Expired() bool {
+	return !self.Expiration.IsZero() && time.Now().After(self.Expiration)
+}
+
+//
+// Flights
+//
+
+type Flights struct {
+	flights map[CacheKey]*Flight
+	lock    sync.Mutex
+}
+
+func NewFlights() *Flights {
+	return &Flights{
+		flights: make(map[CacheKey]*Flight),
+	}
+}
+
+// If the key is already in flight returns that flight and false. Otherwise
+// creates a new flight and returns it and true, in which case the caller must
+// call [Flights.Land] when done.
+func (self *Flights) Join(key CacheKey, expiration time.Time) (*Flight, bool) {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+
+	if flight, ok := self.flights[key]; ok && !flight.Expired() {
+		return flight, false
+	}
+
+	flight := NewFlight(expiration)
+	self.flights[key] = flight
+	return flight, true
+}
+
+// Returns the flight if the key is in flight.
+func (self *Flights) Get(key CacheKey) (*Flight, bool) {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+
+	if flight, ok := self.flights[key]; ok && !flight.Expired() {
+		return flight, true
+	}
+
+	return nil, false
+}
+
+// Releases all waiters with the result (which can be nil). Does nothing if
+// the key is not in flight.
+func (self *Flights) Land(key CacheKey, cached *CachedRepresentation) {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+
+	if flight, ok := self.flights[key]; ok {
+		delete(self.flights, key)
+		flight.cached = cached
+		close(flight.done)
+	}
+}
+
+// Removes expired flights (their waiters will time out).
+func (self *Flights) Prune() {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+
+	for key, flight := range self.flights {
+		if flight.Expired() {
+			delete(self.flights, key)
+		}
+	}
+}
@@ -0,0 +1,129 @@
+package platform
+
+import (
+	"bytes"
+	"io"
+)
+
+//
+// StreamEncodeWriter
+//
+// Unlike [EncodeWriter], which buffers the whole body and encodes it on Close,
+// this encodes as it is written to, so that only the encoded body is kept in
+// memory.
+//
+// The first Threshold bytes are held back until we can decide whether to
+// encode at all (see ShouldEncode).
+//
+
+type StreamEncodeWriter struct {
+	Level     int
+	Threshold int
+
+	// Called once, either when Threshold is reached or on Close (with the
+	// whole body). If it returns false the body will be written as is.
+	ShouldEncode func(body []byte) bool
+
+	encoding EncodingType
+	writer   io.Writer
+	encoder  io.WriteCloser
+	pending  *bytes.Buffer // nil once we have decided
+}
+
+func (self EncodingType) NewStreamWriter(writer io.Writer) *StreamEncodeWriter {
+	return &StreamEncodeWriter{
+		Level:    DefaultEncodingLevel,
+		encoding: self,
+		writer:   writer,
+		pending:  bytes.NewBuffer(nil),
+	}
+}
+
+// True if the body is being encoded. Only valid after the decision has been
+// made.
+func (self *StreamEncodeWriter) Encoding() bool {
+	return self.encoder != nil
+}
+
+// ([io.Writer] interface)
+func (self *StreamEncodeWriter) Write(b []byte) (int, error) {
+	if self.pending != nil {
+		self.pending.Write(b)
+		if self.pending.Len() >= self.Threshold {
+			if err := self.decide(); err != nil {
+				return 0, err
+			}
+		}
+		return len(b), nil
+	}
+
+	if self.encoder != nil {
+		return self.encoder.Write(b)
+	} else {
+		return self.writer.Write(b)
+	}
+}
+
+// [io.StringWriter] interface
+func (self *StreamEncodeWriter) WriteString(s string) (int, error) {
+	return self.Write([]byte(s))
+}
+
+// [io.ByteWriter] interface
+func (self *StreamEncodeWriter) WriteByte(c byte) error {
+	_, err := self.Write([]byte{c})
+	return err
+}
+
+// Writes everything encoded so far to the wrapped writer, even if Threshold
+// has not been reached.
+func (self *StreamEncodeWriter) Flush() error {
+	if self.pending != nil {
+		if err := self.decide(); err != nil {
+			return err
+		}
+	}
+
+	if flusher, ok := self.encoder.(interface{ Flush() error }); ok {
+		return flusher.Flush()
+	}
+
+	return nil
+}
+
+// ([io.Closer] interface)
+func (self *StreamEncodeWriter) Close() error {
+	if self.pending != nil {
+		if err := self.decide(); err != nil {
+			return err
+		}
+	}
+
+	if self.encoder != nil {
+		return self.encoder.Close()
+	}
+
+	return nil
+}
+
+// ([jst.WrappingWriter] interface)
+func (self *StreamEncodeWriter) GetWrappedWriter() io.Writer {
+	return self.writer
+}
+
+func (self *StreamEncodeWriter) decide() error {
+	pending := self.pending.Bytes()
+	self.pending = nil
+
+	if (self.ShouldEncode == nil) || self.ShouldEncode(pending) {
+		var err error
+		if self.encoder, err = self.encoding.NewEncoder(self.writer, self.Level); err != nil {
+			return err
+		}
+		_, err = self.encoder.Write(pending)
+		return err
+	} else {
+		_, err := self.writer.Write(pending)
+		return err
+	}
+}
@@ -0,0 +1,22 @@
+package preencoding
+
+import (
+	"github.com/tliron/commonlog"
+	"github.com/tliron/prudence/platform"
+)
+
+var log = commonlog.GetLogger("prudence.preencoding")
+
+func RegisterDefaultTypes() {
+	platform.RegisterType("PreEncodingCache", CreatePreEncodingCacheBackend,
+		"cache",
+		"encodings",
+		"levels",
+		"dropIdentity",
+		"minSize",
+		"contentTypes",
+		"excludeContentTypes",
+		"workers",
+		"queueSize",
+	)
+}
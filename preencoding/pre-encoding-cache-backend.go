@@ -0,0 +1,342 @@
+package preencoding
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"runtime"
+	"sync"
+
+	"github.com/tliron/commonjs-goja"
+	"github.com/tliron/go-ard"
+	"github.com/tliron/kutil/util"
+	"github.com/tliron/prudence/platform"
+	"github.com/tliron/prudence/rest"
+)
+
+var DefaultEncodings = []platform.EncodingType{platform.EncodingTypeBrotli, platform.EncodingTypeGZip}
+
+//
+// PreEncodingCacheBackend
+//
+// Wraps another cache backend. Newly stored representations are stored as is
+// and then encoded in the background by a pool of workers, after which they
+// are stored again. This moves the cost of encoding off the request path.
+//
+// If the queue is full the representation is not pre-encoded, in which case
+// missing encodings will be created on demand as usual.
+//
+// Bodies that Compression says should not be encoded (e.g. images) are left
+// as is, including their identity body.
+//
+
+type PreEncodingCacheBackend struct {
+	Encodings    []platform.EncodingType
+	Levels       platform.EncodingLevels
+	DropIdentity bool              // once there is at least one other encoding
+	Compression  *rest.Compression // only MinSize, ContentTypes, and ExcludeContentTypes are used
+
+	cacheBackend platform.CacheBackend
+	queue        chan *job
+	stopping     chan struct{}
+
+	// The latest representation stored per key that is still waiting for a
+	// worker, so that workers won't overwrite newer or deleted representations
+	pending     map[platform.CacheKey]*platform.CachedRepresentation
+	pendingLock sync.Mutex
+}
+
+type job struct {
+	key    platform.CacheKey
+	cached *platform.CachedRepresentation
+	body   map[platform.EncodingType][]byte // snapshot
+}
+
+func NewPreEncodingCacheBackend(cacheBackend platform.CacheBackend, queueSize int) *PreEncodingCacheBackend {
+	return &PreEncodingCacheBackend{
+		Encodings:    DefaultEncodings,
+		Compression:  rest.NewCompression(),
+		cacheBackend: cacheBackend,
+		queue:        make(chan *job, queueSize),
+		stopping:     make(chan struct{}),
+		pending:      make(map[platform.CacheKey]*platform.CachedRepresentation),
+	}
+}
+
+// ([platform.CreateFunc] signature)
+func CreatePreEncodingCacheBackend(jsContext *commonjs.Context, config ard.StringMap) (any, error) {
+	config_ := ard.With(config).ConvertSimilar().NilMeansZero()
+
+	var cacheBackend platform.CacheBackend
+	if cache := config_.Get("cache").Value; cache != nil {
+		var ok bool
+		if cacheBackend, ok = cache.(platform.CacheBackend); !ok {
+			return nil, fmt.Errorf("PreEncodingCache \"cache\" is not a cache backend: %T", cache)
+		}
+	} else {
+		return nil, errors.New("PreEncodingCache must have a \"cache\"")
+	}
+
+	var workers int64
+	var queueSize int64
+	var ok bool
+	if workers, ok = config_.Get("workers").Integer(); !ok || (workers < 1) {
+		workers = int64(runtime.NumCPU())
+	}
+	if queueSize, ok = config_.Get("queueSize").Integer(); !ok || (queueSize < 1) {
+		queueSize = 1000
+	}
+
+	self := NewPreEncodingCacheBackend(cacheBackend, int(queueSize))
+
+	if encodings := config_.Get("encodings"); encodings.Value != nil {
+		self.Encodings = nil
+		for _, name := range platform.AsStringList(encodings) {
+			switch encoding := platform.GetEncodingFromHeader(name); encoding {
+			case platform.EncodingTypeBrotli, platform.EncodingTypeDeflate, platform.EncodingTypeGZip, platform.EncodingTypeZstandard:
+				self.Encodings = append(self.Encodings, encoding)
+
+			default:
+				return nil, fmt.Errorf("PreEncodingCache \"encodings\" contains an unsupported encoding: %s", name)
+			}
+		}
+	}
+
+	if levels, ok := config_.Get("levels").StringMap(); ok {
+		self.Levels = make(platform.EncodingLevels)
+		for name, level := range levels {
+			encoding := platform.GetEncodingFromHeader(name)
+			if encoding == platform.EncodingTypeUnsupported {
+				return nil, fmt.Errorf("PreEncodingCache \"levels\" contains an unsupported encoding: %s", name)
+			}
+
+			if level_, ok := ard.With(level).ConvertSimilar().Integer(); ok {
+				self.Levels[encoding] = int(level_)
+			} else {
+				return nil, fmt.Errorf("PreEncodingCache \"levels\" value is not an integer: %s", name)
+			}
+		}
+	}
+
+	self.DropIdentity, _ = config_.Get("dropIdentity").Boolean()
+
+	if minSize, ok := config_.Get("minSize").UnsignedInteger(); ok {
+		self.Compression.MinSize = int(minSize)
+	}
+
+	self.Compression.ContentTypes = platform.AsStringList(config_.Get("contentTypes"))
+
+	if excludeContentTypes := config_.Get("excludeContentTypes"); excludeContentTypes.Value != nil {
+		self.Compression.ExcludeContentTypes = platform.AsStringList(excludeContentTypes)
+	}
+
+	self.StartWorkers(int(workers))
+	util.OnExit(self.StopWorkers)
+
+	return self, nil
+}
+
+// ([platform.CacheBackend] interface)
+func (self *PreEncodingCacheBackend) LoadRepresentation(key platform.CacheKey) (*platform.CachedRepresentation, bool) {
+	return self.cacheBackend.LoadRepresentation(key)
+}
+
+// ([platform.CacheBackend] interface)
+func (self *PreEncodingCacheBackend) StoreRepresentation(key platform.CacheKey, cached *platform.CachedRepresentation) {
+	// Snapshot the body before the representation is shared, because
+	// CachedRepresentation.GetBody may add to it
+	var job_ *job
+	if self.needsEncoding(cached) {
+		body := make(map[platform.EncodingType][]byte, len(cached.Body))
+		for encoding, body_ := range cached.Body {
+			body[encoding] = body_
+		}
+		job_ = &job{key, cached, body}
+	}
+
+	self.cacheBackend.StoreRepresentation(key, cached)
+
+	self.pendingLock.Lock()
+	defer self.pendingLock.Unlock()
+
+	if job_ == nil {
+		delete(self.pending, key)
+		return
+	}
+
+	select {
+	case self.queue <- job_:
+		self.pending[key] = cached
+
+	default:
+		delete(self.pending, key)
+		log.Debugf("queue is full, not pre-encoding: %s", key)
+	}
+}
+
+// ([platform.CacheBackend] interface)
+func (self *PreEncodingCacheBackend) DeleteRepresentation(key platform.CacheKey) {
+	self.pendingLock.Lock()
+	delete(self.pending, key)
+	self.pendingLock.Unlock()
+
+	self.cacheBackend.DeleteRepresentation(key)
+}
+
+// ([platform.CacheBackend] interface)
+func (self *PreEncodingCacheBackend) DeleteGroup(name platform.CacheKey) {
+	self.pendingLock.Lock()
+	for key, cached := range self.pending {
+		for _, group := range cached.Groups {
+			if group == name {
+				delete(self.pending, key)
+				break
+			}
+		}
+	}
+	self.pendingLock.Unlock()
+
+	self.cacheBackend.DeleteGroup(name)
+}
+
+// ([platform.CacheInspector] interface)
+func (self *PreEncodingCacheBackend) IterateEntries(iterate func(entry *platform.CacheEntry) bool) {
+	if cacheInspector, ok := self.cacheBackend.(platform.CacheInspector); ok {
+		cacheInspector.IterateEntries(iterate)
+	}
+}
+
+// ([platform.CacheInspector] interface)
+func (self *PreEncodingCacheBackend) GetMetrics() map[string]any {
+	var metrics map[string]any
+	if cacheInspector, ok := self.cacheBackend.(platform.CacheInspector); ok {
+		metrics = cacheInspector.GetMetrics()
+	}
+
+	self.pendingLock.Lock()
+	pending := len(self.pending)
+	self.pendingLock.Unlock()
+
+	return map[string]any{
+		"pending": pending,
+		"cache":   metrics,
+	}
+}
+
+// ([platform.CacheCoalescer] interface)
+func (self *PreEncodingCacheBackend) JoinRendering(key platform.CacheKey) *platform.Flight {
+	if cacheCoalescer, ok := self.cacheBackend.(platform.CacheCoalescer); ok {
+		return cacheCoalescer.JoinRendering(key)
+	}
+	return nil
+}
+
+// ([platform.CacheCoalescer] interface)
+func (self *PreEncodingCacheBackend) LeaveRendering(key platform.CacheKey) {
+	if cacheCoalescer, ok := self.cacheBackend.(platform.CacheCoalescer); ok {
+		cacheCoalescer.LeaveRendering(key)
+	}
+}
+
+// ([platform.EventRelay] interface)
+func (self *PreEncodingCacheBackend) RelayEvent(event *platform.Event) {
+	if eventRelay, ok := self.cacheBackend.(platform.EventRelay); ok {
+		eventRelay.RelayEvent(event)
+	}
+}
+
+// platform.HasStartables interface
+func (self *PreEncodingCacheBackend) GetStartables() []platform.Startable {
+	if hasStartables, ok := self.cacheBackend.(platform.HasStartables); ok {
+		return hasStartables.GetStartables()
+	} else if startable, ok := self.cacheBackend.(platform.Startable); ok {
+		return []platform.Startable{startable}
+	}
+	return nil
+}
+
+func (self *PreEncodingCacheBackend) StartWorkers(workers int) {
+	for worker := 0; worker < workers; worker++ {
+		go func() {
+			for {
+				select {
+				case job_ := <-self.queue:
+					self.encode(job_)
+
+				case <-self.stopping:
+					return
+				}
+			}
+		}()
+	}
+}
+
+func (self *PreEncodingCacheBackend) StopWorkers() {
+	close(self.stopping)
+}
+
+func (self *PreEncodingCacheBackend) needsEncoding(cached *platform.CachedRepresentation) bool {
+	body := cached.Body
+	if len(body) == 0 {
+		// HEAD or no body
+		return false
+	}
+
+	// Like GetCachedRepresentationBody, we can only check the identity body
+	if identity, ok := body[platform.EncodingTypeIdentity]; ok {
+		if !self.Compression.ShouldEncode(http.Header(cached.Headers).Get(rest.HeaderContentType), len(identity)) {
+			return false
+		}
+	}
+
+	if self.DropIdentity && (len(body) > 1) {
+		if _, ok := body[platform.EncodingTypeIdentity]; ok {
+			return true
+		}
+	}
+
+	for _, encoding := range self.Encodings {
+		if _, ok := body[encoding]; !ok {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (self *PreEncodingCacheBackend) encode(job_ *job) {
+	if !self.isPending(job_) {
+		return
+	}
+
+	// Encode into a copy
+	encoded := *job_.cached
+	encoded.Body = job_.body
+	for _, encoding := range self.Encodings {
+		encoded.GetBodyLevel(encoding, self.Levels.Get(encoding))
+	}
+
+	if self.DropIdentity && (len(encoded.Body) > 1) {
+		delete(encoded.Body, platform.EncodingTypeIdentity)
+	}
+
+	self.pendingLock.Lock()
+	defer self.pendingLock.Unlock()
+
+	// It might have been replaced or deleted while we were encoding
+	if self.pending[job_.key] == job_.cached {
+		delete(self.pending, job_.key)
+		self.cacheBackend.StoreRepresentation(job_.key, &encoded)
+		log.Debug("pre-encoded",
+			"key", job_.key,
+			"encodings", encoded.String(),
+		)
+	}
+}
+
+func (self *PreEncodingCacheBackend) isPending(job_ *job) bool {
+	self.pendingLock.Lock()
+	defer self.pendingLock.Unlock()
+
+	return self.pending[job_.key] == job_.cached
+}
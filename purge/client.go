@@ -0,0 +1,28 @@
+package purge
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+)
+
+const DEFAULT_TIMEOUT_SECONDS = 10.0
+
+// Sends the request and makes sure the response status is 2xx.
+func do(client *http.Client, request *http.Request) error {
+	response, err := client.Do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+
+	// Drain the body so that the connection can be reused
+	io.Copy(io.Discard, response.Body)
+
+	if (response.StatusCode < 200) || (response.StatusCode >= 300) {
+		return fmt.Errorf("%s %s: %s", request.Method, request.URL.String(), response.Status)
+	}
+
+	log.Debugf("%s %s: %s", request.Method, request.URL.String(), response.Status)
+	return nil
+}
@@ -0,0 +1,24 @@
+package purge
+
+import (
+	"github.com/tliron/commonlog"
+	"github.com/tliron/prudence/platform"
+)
+
+var log = commonlog.GetLogger("prudence.purge")
+
+func RegisterDefaultTypes() {
+	platform.RegisterType("VarnishPurger", CreateVarnishPurger,
+		"urls",
+		"method",
+		"header",
+		"timeout",
+	)
+
+	platform.RegisterType("WebhookPurger", CreateWebhookPurger,
+		"url",
+		"method",
+		"headers",
+		"timeout",
+	)
+}
@@ -0,0 +1,94 @@
+package purge
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/tliron/commonjs-goja"
+	"github.com/tliron/go-ard"
+	"github.com/tliron/prudence/platform"
+)
+
+//
+// VarnishPurger
+//
+// Sends a PURGE or BAN request to each Varnish server with the purged groups
+// in a header, space-separated. It is up to the VCL to handle the request,
+// e.g. with the xkey vmod or with a ban on the Surrogate-Key response header.
+//
+
+type VarnishPurger struct {
+	URLs   []string
+	Method string // "PURGE" or "BAN"
+	Header string
+
+	client *http.Client
+}
+
+func NewVarnishPurger(urls []string, timeout time.Duration) *VarnishPurger {
+	return &VarnishPurger{
+		URLs:   urls,
+		Method: "PURGE",
+		Header: "Surrogate-Key",
+		client: &http.Client{Timeout: timeout},
+	}
+}
+
+// ([platform.CreateFunc] signature)
+func CreateVarnishPurger(jsContext *commonjs.Context, config ard.StringMap) (any, error) {
+	config_ := ard.With(config).ConvertSimilar().NilMeansZero()
+
+	urls := platform.AsStringList(config_.Get("urls"))
+	if len(urls) == 0 {
+		return nil, errors.New("VarnishPurger must have \"urls\"")
+	}
+
+	timeout := DEFAULT_TIMEOUT_SECONDS
+	if timeout_, ok := config_.Get("timeout").Float(); ok {
+		timeout = timeout_
+	}
+
+	self := NewVarnishPurger(urls, time.Duration(timeout*float64(time.Second)))
+
+	if method, ok := config_.Get("method").String(); ok {
+		switch method = strings.ToUpper(method); method {
+		case "PURGE", "BAN":
+			self.Method = method
+
+		default:
+			return nil, fmt.Errorf("VarnishPurger \"method\" must be \"PURGE\" or \"BAN\": %s", method)
+		}
+	}
+
+	if header, ok := config_.Get("header").String(); ok {
+		self.Header = header
+	}
+
+	return self, nil
+}
+
+// ([platform.CachePurger] interface)
+func (self *VarnishPurger) PurgeGroups(names []platform.CacheKey) error {
+	names_ := make([]string, len(names))
+	for index, name := range names {
+		names_[index] = string(name)
+	}
+	value := strings.Join(names_, " ")
+
+	var errs []error
+	for _, url := range self.URLs {
+		if request, err := http.NewRequest(self.Method, url, nil); err == nil {
+			request.Header.Set(self.Header, value)
+			if err := do(self.client, request); err != nil {
+				errs = append(errs, err)
+			}
+		} else {
+			errs = append(errs, err)
+		}
+	}
+
+	return errors.Join(errs...)
+}
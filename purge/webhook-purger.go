@@ -0,0 +1,89 @@
+package purge
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/tliron/commonjs-goja"
+	"github.com/tliron/go-ard"
+	"github.com/tliron/prudence/platform"
+)
+
+//
+// WebhookPurger
+//
+// Sends all the purged groups in a single JSON request body:
+//
+//	{"groups": ["group1", "group2"]}
+//
+
+type WebhookPurger struct {
+	URL     string
+	Method  string
+	Headers map[string]string // e.g. for authorization
+
+	client *http.Client
+}
+
+func NewWebhookPurger(url string, timeout time.Duration) *WebhookPurger {
+	return &WebhookPurger{
+		URL:    url,
+		Method: "POST",
+		client: &http.Client{Timeout: timeout},
+	}
+}
+
+// ([platform.CreateFunc] signature)
+func CreateWebhookPurger(jsContext *commonjs.Context, config ard.StringMap) (any, error) {
+	config_ := ard.With(config).ConvertSimilar().NilMeansZero()
+
+	url, _ := config_.Get("url").String()
+	if url == "" {
+		return nil, errors.New("WebhookPurger must have a \"url\"")
+	}
+
+	timeout := DEFAULT_TIMEOUT_SECONDS
+	if timeout_, ok := config_.Get("timeout").Float(); ok {
+		timeout = timeout_
+	}
+
+	self := NewWebhookPurger(url, time.Duration(timeout*float64(time.Second)))
+
+	if method, ok := config_.Get("method").String(); ok {
+		self.Method = method
+	}
+
+	if headers, ok := config_.Get("headers").StringMap(); ok {
+		self.Headers = make(map[string]string)
+		for name, value := range headers {
+			if value_, ok := value.(string); ok {
+				self.Headers[name] = value_
+			}
+		}
+	}
+
+	return self, nil
+}
+
+// ([platform.CachePurger] interface)
+func (self *WebhookPurger) PurgeGroups(names []platform.CacheKey) error {
+	body, err := json.Marshal(map[string]any{"groups": names})
+	if err != nil {
+		return err
+	}
+
+	request, err := http.NewRequest(self.Method, self.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+
+	request.Header.Set("Content-Type", "application/json")
+	for name, value := range self.Headers {
+		request.Header.Set(name, value)
+	}
+
+	return do(self.client, request)
+}
@@ -0,0 +1,327 @@
+package redis
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"time"
+)
+
+// See: https://redis.io/docs/reference/protocol-spec/
+
+//
+// Error
+//
+
+type Error string
+
+// ([error] interface)
+func (self Error) Error() string {
+	return string(self)
+}
+
+//
+// Client
+//
+// A minimal RESP (REdis Serialization Protocol) client with a connection pool.
+// Should work with any Redis-compatible server.
+//
+
+type Client struct {
+	Address  string
+	Username string
+	Password string
+	Database int64
+	Timeout  time.Duration
+
+	pool chan *connection
+}
+
+func NewClient(address string, poolSize int) *Client {
+	return &Client{
+		Address: address,
+		Timeout: 5 * time.Second,
+		pool:    make(chan *connection, poolSize),
+	}
+}
+
+// Sends a command and returns the reply. Replies can be nil, string (for both
+// simple and bulk strings), int64, or []any. Errors returned by the server are
+// of type [Error].
+func (self *Client) Do(arguments ...any) (any, error) {
+	connection, err := self.get()
+	if err != nil {
+		return nil, err
+	}
+
+	if reply, err := connection.do(self.Timeout, arguments...); err == nil {
+		self.put(connection)
+		return reply, nil
+	} else {
+		var redisError Error
+		if errors.As(err, &redisError) {
+			// The connection is still usable
+			self.put(connection)
+		} else {
+			connection.close()
+		}
+		return nil, err
+	}
+}
+
+// Sends several commands at once and returns their replies in order. Errors
+// returned by the server for individual commands are returned as [Error]
+// replies rather than as the error.
+func (self *Client) Pipeline(commands ...[]any) ([]any, error) {
+	if len(commands) == 0 {
+		return nil, nil
+	}
+
+	connection, err := self.get()
+	if err != nil {
+		return nil, err
+	}
+
+	if replies, err := connection.pipeline(self.Timeout, commands); err == nil {
+		self.put(connection)
+		return replies, nil
+	} else {
+		connection.close()
+		return nil, err
+	}
+}
+
+func (self *Client) Close() {
+	for {
+		select {
+		case connection := <-self.pool:
+			connection.close()
+		default:
+			return
+		}
+	}
+}
+
+func (self *Client) get() (*connection, error) {
+	select {
+	case connection := <-self.pool:
+		return connection, nil
+	default:
+		return self.connect()
+	}
+}
+
+func (self *Client) put(connection *connection) {
+	select {
+	case self.pool <- connection:
+	default:
+		// Pool is full
+		connection.close()
+	}
+}
+
+func (self *Client) connect() (*connection, error) {
+	conn, err := net.DialTimeout("tcp", self.Address, self.Timeout)
+	if err != nil {
+		return nil, err
+	}
+
+	connection := &connection{
+		conn:   conn,
+		reader: bufio.NewReader(conn),
+		writer: bufio.NewWriter(conn),
+	}
+
+	if self.Password != "" {
+		var err error
+		if self.Username != "" {
+			_, err = connection.do(self.Timeout, "AUTH", self.Username, self.Password)
+		} else {
+			_, err = connection.do(self.Timeout, "AUTH", self.Password)
+		}
+		if err != nil {
+			connection.close()
+			return nil, err
+		}
+	}
+
+	if self.Database != 0 {
+		if _, err := connection.do(self.Timeout, "SELECT", self.Database); err != nil {
+			connection.close()
+			return nil, err
+		}
+	}
+
+	return connection, nil
+}
+
+//
+// connection
+//
+
+type connection struct {
+	conn   net.Conn
+	reader *bufio.Reader
+	writer *bufio.Writer
+}
+
+func (self *connection) do(timeout time.Duration, arguments ...any) (any, error) {
+	if err := self.conn.SetDeadline(time.Now().Add(timeout)); err != nil {
+		return nil, err
+	}
+
+	if err := self.writeCommand(arguments); err != nil {
+		return nil, err
+	}
+
+	if err := self.writer.Flush(); err != nil {
+		return nil, err
+	}
+
+	return self.readReply()
+}
+
+func (self *connection) pipeline(timeout time.Duration, commands [][]any) ([]any, error) {
+	if err := self.conn.SetDeadline(time.Now().Add(timeout)); err != nil {
+		return nil, err
+	}
+
+	for _, arguments := range commands {
+		if err := self.writeCommand(arguments); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := self.writer.Flush(); err != nil {
+		return nil, err
+	}
+
+	replies := make([]any, len(commands))
+	for index := range replies {
+		var err error
+		if replies[index], err = self.readReply(); err != nil {
+			var redisError Error
+			if errors.As(err, &redisError) {
+				replies[index] = redisError
+			} else {
+				return nil, err
+			}
+		}
+	}
+
+	return replies, nil
+}
+
+func (self *connection) close() {
+	if err := self.conn.Close(); err != nil {
+		log.Warning(err.Error())
+	}
+}
+
+func (self *connection) writeCommand(arguments []any) error {
+	self.writer.WriteByte('*')
+	self.writer.WriteString(strconv.Itoa(len(arguments)))
+	self.writer.WriteString("\r\n")
+
+	for _, argument := range arguments {
+		var bytes []byte
+		switch argument_ := argument.(type) {
+		case []byte:
+			bytes = argument_
+		case string:
+			bytes = []byte(argument_)
+		case int:
+			bytes = strconv.AppendInt(nil, int64(argument_), 10)
+		case int64:
+			bytes = strconv.AppendInt(nil, argument_, 10)
+		default:
+			return fmt.Errorf("unsupported argument type: %T", argument)
+		}
+
+		self.writer.WriteByte('$')
+		self.writer.WriteString(strconv.Itoa(len(bytes)))
+		self.writer.WriteString("\r\n")
+		self.writer.Write(bytes)
+		self.writer.WriteString("\r\n")
+	}
+
+	return nil
+}
+
+func (self *connection) readReply() (any, error) {
+	line, err := self.readLine()
+	if err != nil {
+		return nil, err
+	}
+
+	if len(line) == 0 {
+		return nil, errors.New("empty reply")
+	}
+
+	switch line[0] {
+	case '+':
+		return line[1:], nil
+
+	case '-':
+		return nil, Error(line[1:])
+
+	case ':':
+		return strconv.ParseInt(line[1:], 10, 64)
+
+	case '$':
+		if length, err := strconv.Atoi(line[1:]); err == nil {
+			if length < 0 {
+				return nil, nil
+			}
+
+			bytes := make([]byte, length+2) // including "\r\n"
+			if _, err := io.ReadFull(self.reader, bytes); err == nil {
+				return string(bytes[:length]), nil
+			} else {
+				return nil, err
+			}
+		} else {
+			return nil, err
+		}
+
+	case '*':
+		if length, err := strconv.Atoi(line[1:]); err == nil {
+			if length < 0 {
+				return nil, nil
+			}
+
+			array := make([]any, length)
+			for index := range array {
+				if array[index], err = self.readReply(); err != nil {
+					var redisError Error
+					if errors.As(err, &redisError) {
+						// Errors can be elements of arrays
+						array[index] = redisError
+					} else {
+						return nil, err
+					}
+				}
+			}
+			return array, nil
+		} else {
+			return nil, err
+		}
+
+	default:
+		return nil, fmt.Errorf("unsupported reply: %q", line)
+	}
+}
+
+func (self *connection) readLine() (string, error) {
+	if line, err := self.reader.ReadString('\n'); err == nil {
+		if (len(line) < 2) || (line[len(line)-2] != '\r') {
+			return "", fmt.Errorf("malformed reply: %q", line)
+		}
+		return line[:len(line)-2], nil
+	} else {
+		return "", err
+	}
+}
@@ -0,0 +1,20 @@
+package redis
+
+import (
+	"github.com/tliron/commonlog"
+	"github.com/tliron/prudence/platform"
+)
+
+var log = commonlog.GetLogger("prudence.redis")
+
+func RegisterDefaultTypes() {
+	platform.RegisterType("RedisCache", CreateRedisCacheBackend,
+		"address",
+		"username",
+		"password",
+		"database",
+		"prefix",
+		"timeout",
+		"poolSize",
+	)
+}
@@ -0,0 +1,344 @@
+package redis
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/fxamacker/cbor/v2"
+	"github.com/tliron/commonjs-goja"
+	"github.com/tliron/go-ard"
+	"github.com/tliron/kutil/util"
+	"github.com/tliron/prudence/platform"
+)
+
+// Adds a representation key to a group. Groups are sets of representation
+// keys that expire no sooner than their longest-lived member.
+//
+// Note that we only access declared keys, so that this works with
+// Redis-compatible servers that enforce declared keys.
+//
+// KEYS[1] = group key
+// ARGV[1] = representation key, ARGV[2] = TTL in milliseconds
+const addToGroupScript = `
+redis.call('SADD', KEYS[1], ARGV[1])
+local ttl = tonumber(ARGV[2])
+if redis.call('PTTL', KEYS[1]) < ttl then
+	redis.call('PEXPIRE', KEYS[1], ttl)
+end
+return 0
+`
+
+// Atomically deletes a group and its members. Because we may only access
+// declared keys the caller must first read the members and declare them. If
+// the members have changed since then nothing is deleted and we return -1, so
+// that the caller can try again. Otherwise returns the number of
+// representations deleted.
+//
+// KEYS[1] = group key
+// KEYS[2...] = representation keys (the group's members)
+const deleteGroupScript = `
+local members = redis.call('SMEMBERS', KEYS[1])
+if #members ~= #KEYS - 1 then
+	return -1
+end
+local declared = {}
+for index = 2, #KEYS do
+	declared[KEYS[index]] = true
+end
+for _, member in ipairs(members) do
+	if not declared[member] then
+		return -1
+	end
+end
+local count = 0
+for index = 2, #KEYS do
+	count = count + redis.call('DEL', KEYS[index])
+end
+redis.call('DEL', KEYS[1])
+return count
+`
+
+// How many times to try deleting a group whose members keep changing.
+const deleteGroupAttempts = 10
+
+var globEscaper = strings.NewReplacer(`\`, `\\`, `*`, `\*`, `?`, `\?`, `[`, `\[`, `]`, `\]`)
+
+//
+// RedisCacheBackend
+//
+
+type RedisCacheBackend struct {
+	Prefix string
+
+	client *Client
+}
+
+func NewRedisCacheBackend(client *Client, prefix string) *RedisCacheBackend {
+	return &RedisCacheBackend{
+		Prefix: prefix,
+		client: client,
+	}
+}
+
+// ([platform.CreateFunc] signature)
+func CreateRedisCacheBackend(jsContext *commonjs.Context, config ard.StringMap) (any, error) {
+	config_ := ard.With(config).ConvertSimilar().NilMeansZero()
+
+	var address string
+	var prefix string
+	var poolSize int64
+	var ok bool
+	if address, ok = config_.Get("address").String(); !ok {
+		address = "localhost:6379"
+	}
+	if prefix, ok = config_.Get("prefix").String(); !ok {
+		prefix = "prudence:"
+	}
+	if poolSize, ok = config_.Get("poolSize").Integer(); !ok {
+		poolSize = 10
+	}
+
+	client := NewClient(address, int(poolSize))
+	client.Username, _ = config_.Get("username").String()
+	client.Password, _ = config_.Get("password").String()
+	client.Database, _ = config_.Get("database").Integer()
+	if timeout, ok := config_.Get("timeout").Float(); ok {
+		client.Timeout = time.Duration(timeout * float64(time.Second))
+	}
+
+	util.OnExit(client.Close)
+
+	return NewRedisCacheBackend(client, prefix), nil
+}
+
+// ([platform.CacheBackend] interface)
+func (self *RedisCacheBackend) LoadRepresentation(key platform.CacheKey) (*platform.CachedRepresentation, bool) {
+	if reply, err := self.client.Do("GET", self.representationKey(key)); err == nil {
+		if reply == nil {
+			return nil, false
+		}
+
+		if data, ok := reply.(string); ok {
+			var cached platform.CachedRepresentation
+			if err := cbor.Unmarshal(util.StringToBytes(data), &cached); err == nil {
+				if cached.Body == nil {
+					cached.Body = make(map[platform.EncodingType][]byte)
+				}
+				return &cached, true
+			} else {
+				log.Errorf("could not decode representation: %s", err.Error())
+			}
+		}
+	} else {
+		log.Errorf("could not load representation: %s", err.Error())
+	}
+
+	return nil, false
+}
+
+// ([platform.CacheBackend] interface)
+func (self *RedisCacheBackend) StoreRepresentation(key platform.CacheKey, cached *platform.CachedRepresentation) {
+	// Redis expiration is in whole milliseconds and must be positive
+	ttl := time.Until(cached.Retention()).Milliseconds()
+	if ttl <= 0 {
+		return
+	}
+
+	data, err := cbor.Marshal(cached)
+	if err != nil {
+		log.Errorf("could not encode representation: %s", err.Error())
+		return
+	}
+
+	go func() {
+		representationKey := self.representationKey(key)
+
+		// The representation must be stored before it is added to groups,
+		// otherwise deleting a group concurrently might miss it
+		if _, err := self.client.Do("SET", representationKey, data, "PX", ttl); err != nil {
+			log.Errorf("could not store representation: %s", err.Error())
+			return
+		}
+
+		commands := make([][]any, len(cached.Groups))
+		for index, group := range cached.Groups {
+			commands[index] = []any{"EVAL", addToGroupScript, 1, self.groupKey(group), representationKey, ttl}
+		}
+
+		if replies, err := self.client.Pipeline(commands...); err == nil {
+			for _, reply := range replies {
+				if err, ok := reply.(Error); ok {
+					log.Errorf("could not add representation to group: %s", err.Error())
+				}
+			}
+		} else {
+			log.Errorf("could not add representation to groups: %s", err.Error())
+		}
+	}()
+}
+
+// ([platform.CacheBackend] interface)
+func (self *RedisCacheBackend) DeleteRepresentation(key platform.CacheKey) {
+	go func() {
+		if _, err := self.client.Do("DEL", self.representationKey(key)); err != nil {
+			log.Errorf("could not delete representation: %s", err.Error())
+		}
+	}()
+}
+
+// ([platform.CacheBackend] interface)
+func (self *RedisCacheBackend) DeleteGroup(name platform.CacheKey) {
+	go func() {
+		if count, err := self.deleteGroup(name); err == nil {
+			log.Debug("deleted group", "group", name, "representations", count)
+		} else {
+			log.Errorf("could not delete group: %s", err.Error())
+		}
+	}()
+}
+
+// See deleteGroupScript.
+func (self *RedisCacheBackend) deleteGroup(name platform.CacheKey) (int, error) {
+	groupKey := self.groupKey(name)
+
+	for attempt := 0; attempt < deleteGroupAttempts; attempt++ {
+		reply, err := self.client.Do("SMEMBERS", groupKey)
+		if err != nil {
+			return 0, err
+		}
+
+		members, _ := reply.([]any)
+		arguments := make([]any, 0, 3+len(members))
+		arguments = append(arguments, "EVAL", deleteGroupScript, 1+len(members), groupKey)
+		arguments = append(arguments, members...)
+
+		if reply, err = self.client.Do(arguments...); err != nil {
+			return 0, err
+		}
+
+		if count, ok := reply.(int64); ok && (count >= 0) {
+			return int(count), nil
+		}
+	}
+
+	return 0, fmt.Errorf("group keeps changing: %s", name)
+}
+
+// ([platform.CacheInspector] interface)
+func (self *RedisCacheBackend) IterateEntries(iterate func(entry *platform.CacheEntry) bool) {
+	representationPrefix := self.Prefix + "representation:"
+	groupPrefix := self.Prefix + "group:"
+
+	groups := make(map[string][]platform.CacheKey)
+	if err := self.scan(groupPrefix, func(keys []string) bool {
+		for _, key := range keys {
+			if members, err := self.client.Do("SMEMBERS", key); err == nil {
+				if members, ok := members.([]any); ok {
+					name := platform.CacheKey(key[len(groupPrefix):])
+					for _, member := range members {
+						if member, ok := member.(string); ok {
+							groups[member] = append(groups[member], name)
+						}
+					}
+				}
+			} else {
+				log.Errorf("could not inspect group: %s", err.Error())
+			}
+		}
+		return true
+	}); err != nil {
+		log.Errorf("could not inspect groups: %s", err.Error())
+		return
+	}
+
+	if err := self.scan(representationPrefix, func(keys []string) bool {
+		if len(keys) == 0 {
+			return true
+		}
+
+		commands := make([][]any, 0, 2*len(keys))
+		for _, key := range keys {
+			commands = append(commands, []any{"STRLEN", key}, []any{"PTTL", key})
+		}
+
+		if reply, err := self.client.Pipeline(commands...); err == nil {
+			if len(reply) == 2*len(keys) {
+				now := time.Now()
+				for index, key := range keys {
+					size, _ := reply[2*index].(int64)
+					ttl, _ := reply[2*index+1].(int64)
+					if ttl < 0 {
+						// Does not exist anymore
+						continue
+					}
+
+					if !iterate(&platform.CacheEntry{
+						Key:        platform.CacheKey(key[len(representationPrefix):]),
+						Groups:     groups[key],
+						Size:       size,
+						Expiration: now.Add(time.Duration(ttl) * time.Millisecond),
+					}) {
+						return false
+					}
+				}
+			}
+		} else {
+			log.Errorf("could not inspect representations: %s", err.Error())
+		}
+
+		return true
+	}); err != nil {
+		log.Errorf("could not inspect representations: %s", err.Error())
+	}
+}
+
+// ([platform.CacheInspector] interface)
+func (self *RedisCacheBackend) GetMetrics() map[string]any {
+	metrics := map[string]any{
+		"address": self.client.Address,
+	}
+	if size, err := self.client.Do("DBSIZE"); err == nil {
+		metrics["databaseSize"] = size
+	}
+	return metrics
+}
+
+// Calls the function for each page of keys until it returns false.
+func (self *RedisCacheBackend) scan(prefix string, page func(keys []string) bool) error {
+	pattern := globEscaper.Replace(prefix) + "*"
+	cursor := "0"
+	for {
+		reply, err := self.client.Do("SCAN", cursor, "MATCH", pattern, "COUNT", 100)
+		if err != nil {
+			return err
+		}
+
+		var keys []string
+		if reply, ok := reply.([]any); ok && (len(reply) == 2) {
+			cursor, _ = reply[0].(string)
+			if keys_, ok := reply[1].([]any); ok {
+				for _, key := range keys_ {
+					if key, ok := key.(string); ok {
+						keys = append(keys, key)
+					}
+				}
+			}
+		} else {
+			return errors.New("malformed SCAN reply")
+		}
+
+		if !page(keys) || (cursor == "0") || (cursor == "") {
+			return nil
+		}
+	}
+}
+
+func (self *RedisCacheBackend) representationKey(key platform.CacheKey) string {
+	return self.Prefix + "representation:" + string(key)
+}
+
+func (self *RedisCacheBackend) groupKey(name platform.CacheKey) string {
+	return self.Prefix + "group:" + string(name)
+}
@@ -0,0 +1,186 @@
+package redis
+
+import (
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/tliron/prudence/platform"
+)
+
+func TestClientPipeline(t *testing.T) {
+	server := newStubServer(t)
+	client := NewClient(server.Address(), 2)
+	defer client.Close()
+
+	replies, err := client.Pipeline(
+		[]any{"SET", "a", "1"},
+		[]any{"GET", "a"},
+		[]any{"GET", "missing"},
+		[]any{"NOSUCHCOMMAND"},
+		[]any{"STRLEN", "a"},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(replies) != 5 {
+		t.Fatalf("expected 5 replies, got %d", len(replies))
+	}
+	if replies[0] != "OK" {
+		t.Errorf("SET: %#v", replies[0])
+	}
+	if replies[1] != "1" {
+		t.Errorf("GET: %#v", replies[1])
+	}
+	if replies[2] != nil {
+		t.Errorf("GET missing: %#v", replies[2])
+	}
+	if _, ok := replies[3].(Error); !ok {
+		t.Errorf("unknown command did not return an Error reply: %#v", replies[3])
+	}
+	if replies[4] != int64(1) {
+		t.Errorf("STRLEN: %#v", replies[4])
+	}
+
+	// The connection must still be usable after an error reply
+	if reply, err := client.Do("GET", "a"); (err != nil) || (reply != "1") {
+		t.Errorf("GET after pipeline: %#v, %v", reply, err)
+	}
+}
+
+func TestRedisCacheBackend(t *testing.T) {
+	server := newStubServer(t)
+	client := NewClient(server.Address(), 2)
+	defer client.Close()
+	backend := NewRedisCacheBackend(client, "test:")
+
+	store := func(key platform.CacheKey, groups ...platform.CacheKey) {
+		backend.StoreRepresentation(key, &platform.CachedRepresentation{
+			Groups:     groups,
+			Headers:    map[string][]string{"Content-Type": {"text/plain"}},
+			Body:       map[platform.EncodingType][]byte{platform.EncodingTypeIdentity: []byte("body of " + key)},
+			Expiration: time.Now().Add(time.Minute),
+		})
+	}
+
+	// Storing is asynchronous
+	waitFor := func(key platform.CacheKey) *platform.CachedRepresentation {
+		deadline := time.Now().Add(5 * time.Second)
+		for time.Now().Before(deadline) {
+			if cached, ok := backend.LoadRepresentation(key); ok {
+				return cached
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+		t.Fatalf("representation was not stored: %s", key)
+		return nil
+	}
+
+	waitForGroup := func(name platform.CacheKey, size int) {
+		deadline := time.Now().Add(5 * time.Second)
+		for time.Now().Before(deadline) {
+			if members, err := client.Do("SMEMBERS", backend.groupKey(name)); err == nil {
+				if members, _ := members.([]any); len(members) == size {
+					return
+				}
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+		t.Fatalf("group does not have %d members: %s", size, name)
+	}
+
+	store("a", "g1", "g2")
+	store("b", "g1")
+	store("c", "g2")
+
+	cached := waitFor("a")
+	if string(cached.Body[platform.EncodingTypeIdentity]) != "body of a" {
+		t.Errorf("wrong body: %q", cached.Body[platform.EncodingTypeIdentity])
+	}
+	if cached.Headers["Content-Type"][0] != "text/plain" {
+		t.Errorf("wrong headers: %v", cached.Headers)
+	}
+	waitFor("b")
+	waitFor("c")
+	waitForGroup("g1", 2)
+	waitForGroup("g2", 2)
+
+	// Groups must expire no sooner than their members
+	if ttl, err := client.Do("PTTL", backend.groupKey("g1")); (err != nil) || (ttl.(int64) <= 0) {
+		t.Errorf("group does not have a TTL: %#v, %v", ttl, err)
+	}
+
+	// Inspect
+	var keys []string
+	backend.IterateEntries(func(entry *platform.CacheEntry) bool {
+		keys = append(keys, string(entry.Key))
+		if entry.Size <= 0 {
+			t.Errorf("entry has no size: %s", entry.Key)
+		}
+		if entry.Expiration.Before(time.Now()) {
+			t.Errorf("entry has expired: %s", entry.Key)
+		}
+		if entry.Key == "a" {
+			var groups []string
+			for _, group := range entry.Groups {
+				groups = append(groups, string(group))
+			}
+			sort.Strings(groups)
+			if (len(groups) != 2) || (groups[0] != "g1") || (groups[1] != "g2") {
+				t.Errorf("wrong groups: %v", entry.Groups)
+			}
+		}
+		return true
+	})
+	sort.Strings(keys)
+	if (len(keys) != 3) || (keys[0] != "a") || (keys[1] != "b") || (keys[2] != "c") {
+		t.Errorf("wrong entries: %v", keys)
+	}
+
+	// Delete group
+	if count, err := backend.deleteGroup("g1"); err != nil {
+		t.Fatal(err)
+	} else if count != 2 {
+		t.Errorf("deleted %d representations instead of 2", count)
+	}
+	if _, ok := backend.LoadRepresentation("a"); ok {
+		t.Error("representation \"a\" was not deleted")
+	}
+	if _, ok := backend.LoadRepresentation("b"); ok {
+		t.Error("representation \"b\" was not deleted")
+	}
+	if _, ok := backend.LoadRepresentation("c"); !ok {
+		t.Error("representation \"c\" should not have been deleted")
+	}
+	if exists, _ := client.Do("SMEMBERS", backend.groupKey("g1")); len(exists.([]any)) != 0 {
+		t.Error("group was not deleted")
+	}
+
+	// Nothing is deleted if the group's members are not the declared keys
+	store("d", "g3")
+	store("e", "g3")
+	waitFor("d")
+	waitFor("e")
+	waitForGroup("g3", 2)
+	if reply, err := client.Do("EVAL", deleteGroupScript, 2, backend.groupKey("g3"), backend.representationKey("d")); (err != nil) || (reply != int64(-1)) {
+		t.Errorf("deleting a changed group: %#v, %v", reply, err)
+	}
+	if _, ok := backend.LoadRepresentation("d"); !ok {
+		t.Error("representation \"d\" should not have been deleted")
+	}
+	waitForGroup("g3", 2)
+
+	// Deleting an empty group is harmless
+	if count, err := backend.deleteGroup("g1"); (err != nil) || (count != 0) {
+		t.Errorf("deleting empty group: %d, %v", count, err)
+	}
+
+	for _, command := range server.Commands() {
+		switch command {
+		case "SET", "GET", "EVAL", "SMEMBERS", "STRLEN", "PTTL", "SCAN":
+		default:
+			t.Errorf("unexpected command: %s", command)
+		}
+	}
+}
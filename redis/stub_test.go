@@ -0,0 +1,351 @@
+package redis
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+//
+// stubServer
+//
+// A minimal in-process RESP server that supports just the commands we use.
+// Scripts are emulated in Go, touching only their declared keys, and unknown
+// scripts are rejected.
+//
+
+type stubServer struct {
+	listener    net.Listener
+	strings     map[string]string
+	sets        map[string]map[string]struct{}
+	expirations map[string]time.Time
+	commands    []string
+	lock        sync.Mutex
+}
+
+func newStubServer(t *testing.T) *stubServer {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	self := stubServer{
+		listener:    listener,
+		strings:     make(map[string]string),
+		sets:        make(map[string]map[string]struct{}),
+		expirations: make(map[string]time.Time),
+	}
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go self.serve(conn)
+		}
+	}()
+
+	t.Cleanup(func() {
+		listener.Close()
+	})
+
+	return &self
+}
+
+func (self *stubServer) Address() string {
+	return self.listener.Addr().String()
+}
+
+func (self *stubServer) Commands() []string {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+	return append([]string(nil), self.commands...)
+}
+
+func (self *stubServer) serve(conn net.Conn) {
+	defer conn.Close()
+	reader := bufio.NewReader(conn)
+	writer := bufio.NewWriter(conn)
+
+	for {
+		arguments, err := readStubCommand(reader)
+		if err != nil {
+			return
+		}
+
+		self.lock.Lock()
+		self.commands = append(self.commands, strings.ToUpper(arguments[0]))
+		reply := self.execute(arguments)
+		self.lock.Unlock()
+
+		writeStubReply(writer, reply)
+
+		// Flush only when the client has nothing more buffered (pipelining)
+		if reader.Buffered() == 0 {
+			if writer.Flush() != nil {
+				return
+			}
+		}
+	}
+}
+
+// Call when locked.
+func (self *stubServer) execute(arguments []string) any {
+	self.expire()
+
+	switch command := strings.ToUpper(arguments[0]); command {
+	case "AUTH", "SELECT":
+		return "+OK"
+
+	case "GET":
+		if value, ok := self.strings[arguments[1]]; ok {
+			return value
+		}
+		return nil
+
+	case "SET":
+		self.delete(arguments[1])
+		self.strings[arguments[1]] = arguments[2]
+		if (len(arguments) == 5) && strings.EqualFold(arguments[3], "PX") {
+			self.setTTL(arguments[1], arguments[4])
+		}
+		return "+OK"
+
+	case "STRLEN":
+		return int64(len(self.strings[arguments[1]]))
+
+	case "DEL":
+		var count int64
+		for _, key := range arguments[1:] {
+			if self.exists(key) {
+				self.delete(key)
+				count++
+			}
+		}
+		return count
+
+	case "SADD":
+		return self.sadd(arguments[1], arguments[2:]...)
+
+	case "SMEMBERS":
+		var members []any
+		for member := range self.sets[arguments[1]] {
+			members = append(members, member)
+		}
+		return members
+
+	case "PTTL":
+		return self.pttl(arguments[1])
+
+	case "PEXPIRE":
+		if !self.exists(arguments[1]) {
+			return int64(0)
+		}
+		self.setTTL(arguments[1], arguments[2])
+		return int64(1)
+
+	case "SCAN":
+		var keys []string
+		for key := range self.strings {
+			keys = append(keys, key)
+		}
+		for key := range self.sets {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+
+		pattern := arguments[3]
+		matches := []any{}
+		for _, key := range keys {
+			if ok, _ := path.Match(pattern, key); ok {
+				matches = append(matches, key)
+			}
+		}
+		return []any{"0", matches}
+
+	case "DBSIZE":
+		return int64(len(self.strings) + len(self.sets))
+
+	case "EVAL":
+		return self.eval(arguments[1], arguments[2:])
+
+	default:
+		return fmt.Errorf("ERR unknown command '%s'", command)
+	}
+}
+
+// Call when locked.
+func (self *stubServer) eval(script string, arguments []string) any {
+	keyCount, _ := strconv.Atoi(arguments[0])
+	keys := arguments[1 : 1+keyCount]
+	argv := arguments[1+keyCount:]
+
+	switch script {
+	case addToGroupScript:
+		// Only KEYS[1] is accessed; ARGV[1] is just a value
+		self.sadd(keys[0], argv[0])
+		ttl, _ := strconv.ParseInt(argv[1], 10, 64)
+		if self.pttl(keys[0]) < ttl {
+			self.setTTL(keys[0], argv[1])
+		}
+		return int64(0)
+
+	case deleteGroupScript:
+		// Only KEYS are accessed
+		declared := make(map[string]struct{})
+		for _, key := range keys[1:] {
+			declared[key] = struct{}{}
+		}
+		members := self.sets[keys[0]]
+		if len(members) != len(declared) {
+			return int64(-1)
+		}
+		for member := range members {
+			if _, ok := declared[member]; !ok {
+				return int64(-1)
+			}
+		}
+		var count int64
+		for _, key := range keys[1:] {
+			if self.exists(key) {
+				self.delete(key)
+				count++
+			}
+		}
+		self.delete(keys[0])
+		return count
+
+	default:
+		return fmt.Errorf("ERR unsupported script")
+	}
+}
+
+// Call when locked.
+func (self *stubServer) sadd(key string, members ...string) int64 {
+	set, ok := self.sets[key]
+	if !ok {
+		set = make(map[string]struct{})
+		self.sets[key] = set
+	}
+
+	var count int64
+	for _, member := range members {
+		if _, ok := set[member]; !ok {
+			set[member] = struct{}{}
+			count++
+		}
+	}
+	return count
+}
+
+// Call when locked.
+func (self *stubServer) pttl(key string) int64 {
+	if !self.exists(key) {
+		return -2
+	}
+	if expiration, ok := self.expirations[key]; ok {
+		return time.Until(expiration).Milliseconds()
+	}
+	return -1
+}
+
+// Call when locked.
+func (self *stubServer) setTTL(key string, ttl string) {
+	milliseconds, _ := strconv.ParseInt(ttl, 10, 64)
+	self.expirations[key] = time.Now().Add(time.Duration(milliseconds) * time.Millisecond)
+}
+
+// Call when locked.
+func (self *stubServer) exists(key string) bool {
+	if _, ok := self.strings[key]; ok {
+		return true
+	}
+	_, ok := self.sets[key]
+	return ok
+}
+
+// Call when locked.
+func (self *stubServer) delete(key string) {
+	delete(self.strings, key)
+	delete(self.sets, key)
+	delete(self.expirations, key)
+}
+
+// Call when locked.
+func (self *stubServer) expire() {
+	now := time.Now()
+	for key, expiration := range self.expirations {
+		if now.After(expiration) {
+			self.delete(key)
+		}
+	}
+}
+
+func readStubCommand(reader *bufio.Reader) ([]string, error) {
+	line, err := reader.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	if !strings.HasPrefix(line, "*") {
+		return nil, fmt.Errorf("not an array: %q", line)
+	}
+
+	count, err := strconv.Atoi(strings.TrimSpace(line[1:]))
+	if err != nil {
+		return nil, err
+	}
+
+	arguments := make([]string, count)
+	for index := range arguments {
+		if line, err = reader.ReadString('\n'); err != nil {
+			return nil, err
+		}
+		length, err := strconv.Atoi(strings.TrimSpace(line[1:]))
+		if err != nil {
+			return nil, err
+		}
+		bytes := make([]byte, length+2)
+		if _, err := io.ReadFull(reader, bytes); err != nil {
+			return nil, err
+		}
+		arguments[index] = string(bytes[:length])
+	}
+
+	return arguments, nil
+}
+
+func writeStubReply(writer *bufio.Writer, reply any) {
+	switch reply_ := reply.(type) {
+	case nil:
+		writer.WriteString("$-1\r\n")
+
+	case error:
+		writer.WriteString("-" + reply_.Error() + "\r\n")
+
+	case int64:
+		writer.WriteString(":" + strconv.FormatInt(reply_, 10) + "\r\n")
+
+	case string:
+		if strings.HasPrefix(reply_, "+") {
+			// Simple string
+			writer.WriteString(reply_ + "\r\n")
+		} else {
+			writer.WriteString("$" + strconv.Itoa(len(reply_)) + "\r\n" + reply_ + "\r\n")
+		}
+
+	case []any:
+		writer.WriteString("*" + strconv.Itoa(len(reply_)) + "\r\n")
+		for _, element := range reply_ {
+			writeStubReply(writer, element)
+		}
+	}
+}
@@ -0,0 +1,424 @@
+package rest
+
+import (
+	contextpkg "context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/acme"
+)
+
+// See RFC 8737, section 6.1
+var acmeIdentifierOid = asn1.ObjectIdentifier{1, 3, 6, 1, 5, 5, 7, 1, 31}
+
+//
+// stubACMEServer
+//
+// A minimal in-process ACME (RFC 8555) directory that supports just what
+// autocert uses. It offers a single challenge type and validates it
+// synchronously when the client accepts it, by connecting to TLSAddress (for
+// TLS-ALPN-01) or HTTPAddress (for HTTP-01). JWS signatures are not verified.
+//
+
+type stubACMEServer struct {
+	TLSAddress  string
+	HTTPAddress string
+	Roots       *x509.CertPool
+
+	server         *httptest.Server
+	challengeType  string
+	rootKey        *ecdsa.PrivateKey
+	rootCert       *x509.Certificate
+	authorizations []*stubACMEAuthorization
+	orders         []*stubACMEOrder
+	lock           sync.Mutex
+	t              *testing.T
+}
+
+type stubACMEChallenge struct {
+	URI   string `json:"uri"`
+	Type  string `json:"type"`
+	Token string `json:"token"`
+}
+
+type stubACMEAuthorization struct {
+	Status     string              `json:"status"`
+	Challenges []stubACMEChallenge `json:"challenges"`
+
+	domain string
+}
+
+type stubACMEOrder struct {
+	Status         string   `json:"status"`
+	Authorizations []string `json:"authorizations"`
+	Finalize       string   `json:"finalize,omitempty"`
+	Certificate    string   `json:"certificate,omitempty"`
+
+	authorization *stubACMEAuthorization
+	leaf          []byte
+}
+
+func newStubACMEServer(t *testing.T, challengeType string) *stubACMEServer {
+	rootKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	template := x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "Prudence Test ACME Root"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(365 * 24 * time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, &template, &template, &rootKey.PublicKey, rootKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rootCert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	self := stubACMEServer{
+		Roots:         x509.NewCertPool(),
+		challengeType: challengeType,
+		rootKey:       rootKey,
+		rootCert:      rootCert,
+		t:             t,
+	}
+	self.Roots.AddCert(rootCert)
+
+	self.server = httptest.NewServer(http.HandlerFunc(self.handle))
+	t.Cleanup(self.server.Close)
+
+	return &self
+}
+
+func (self *stubACMEServer) URL() string {
+	return self.server.URL + "/"
+}
+
+func (self *stubACMEServer) url(format string, a ...any) string {
+	return self.server.URL + fmt.Sprintf(format, a...)
+}
+
+func (self *stubACMEServer) handle(responseWriter http.ResponseWriter, request *http.Request) {
+	self.t.Logf("ACME: %s %s", request.Method, request.URL.Path)
+
+	// We do not verify nonces
+	responseWriter.Header().Set("Replay-Nonce", "nonce")
+
+	path := request.URL.Path
+	switch {
+	case path == "/":
+		self.writeJSON(responseWriter, http.StatusOK, map[string]string{
+			"newNonce":   self.url("/new-nonce"),
+			"newAccount": self.url("/new-account"),
+			"newOrder":   self.url("/new-order"),
+		})
+
+	case path == "/new-nonce":
+
+	case path == "/new-account":
+		responseWriter.Header().Set("Location", self.url("/account"))
+		self.writeJSON(responseWriter, http.StatusCreated, map[string]string{"status": acme.StatusValid})
+
+	case path == "/new-order":
+		var payload struct {
+			Identifiers []struct{ Value string }
+		}
+		if err := decodeStubACMEPayload(request.Body, &payload); (err != nil) || (len(payload.Identifiers) != 1) {
+			http.Error(responseWriter, "expected a single identifier", http.StatusBadRequest)
+			return
+		}
+
+		self.lock.Lock()
+		defer self.lock.Unlock()
+
+		id := len(self.authorizations)
+		authorization := stubACMEAuthorization{
+			Status: acme.StatusPending,
+			Challenges: []stubACMEChallenge{{
+				URI:   self.url("/challenge/%d", id),
+				Type:  self.challengeType,
+				Token: fmt.Sprintf("token-%s-%d", self.challengeType, id),
+			}},
+			domain: payload.Identifiers[0].Value,
+		}
+		self.authorizations = append(self.authorizations, &authorization)
+
+		order := stubACMEOrder{
+			Status:         acme.StatusPending,
+			Authorizations: []string{self.url("/authz/%d", id)},
+			authorization:  &authorization,
+		}
+		self.orders = append(self.orders, &order)
+
+		responseWriter.Header().Set("Location", self.url("/order/%d", len(self.orders)-1))
+		self.writeJSON(responseWriter, http.StatusCreated, &order)
+
+	case strings.HasPrefix(path, "/order/"):
+		if order := self.getOrder(strings.TrimPrefix(path, "/order/")); order != nil {
+			self.lock.Lock()
+			defer self.lock.Unlock()
+			self.writeJSON(responseWriter, http.StatusOK, order)
+		} else {
+			http.NotFound(responseWriter, request)
+		}
+
+	case strings.HasPrefix(path, "/authz/"):
+		if authorization := self.getAuthorization(strings.TrimPrefix(path, "/authz/")); authorization != nil {
+			self.lock.Lock()
+			defer self.lock.Unlock()
+			self.writeJSON(responseWriter, http.StatusOK, authorization)
+		} else {
+			http.NotFound(responseWriter, request)
+		}
+
+	case strings.HasPrefix(path, "/challenge/"):
+		if authorization := self.getAuthorization(strings.TrimPrefix(path, "/challenge/")); authorization != nil {
+			err := self.validate(authorization)
+
+			self.lock.Lock()
+			defer self.lock.Unlock()
+
+			if err == nil {
+				authorization.Status = acme.StatusValid
+			} else {
+				self.t.Errorf("ACME: %s challenge for %q failed: %s", self.challengeType, authorization.domain, err)
+				authorization.Status = acme.StatusInvalid
+			}
+
+			self.writeJSON(responseWriter, http.StatusOK, &authorization.Challenges[0])
+		} else {
+			http.NotFound(responseWriter, request)
+		}
+
+	case strings.HasPrefix(path, "/finalize/"):
+		id := strings.TrimPrefix(path, "/finalize/")
+		order := self.getOrder(id)
+		if order == nil {
+			http.NotFound(responseWriter, request)
+			return
+		}
+
+		var payload struct {
+			CSR string `json:"csr"`
+		}
+		if err := decodeStubACMEPayload(request.Body, &payload); err != nil {
+			http.Error(responseWriter, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		self.lock.Lock()
+		defer self.lock.Unlock()
+
+		if order.Status != acme.StatusReady {
+			http.Error(responseWriter, "order is not ready", http.StatusForbidden)
+			return
+		}
+
+		leaf, err := self.issue(payload.CSR)
+		if err != nil {
+			http.Error(responseWriter, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		order.leaf = leaf
+		order.Status = acme.StatusValid
+		order.Certificate = self.url("/certificate/%s", id)
+		self.writeJSON(responseWriter, http.StatusOK, order)
+
+	case strings.HasPrefix(path, "/certificate/"):
+		order := self.getOrder(strings.TrimPrefix(path, "/certificate/"))
+		if order == nil {
+			http.NotFound(responseWriter, request)
+			return
+		}
+
+		self.lock.Lock()
+		defer self.lock.Unlock()
+
+		if order.leaf == nil {
+			http.Error(responseWriter, "order has no certificate", http.StatusForbidden)
+			return
+		}
+
+		responseWriter.Header().Set(HeaderContentType, "application/pem-certificate-chain")
+		pem.Encode(responseWriter, &pem.Block{Type: "CERTIFICATE", Bytes: order.leaf})
+		pem.Encode(responseWriter, &pem.Block{Type: "CERTIFICATE", Bytes: self.rootCert.Raw})
+
+	default:
+		http.NotFound(responseWriter, request)
+	}
+}
+
+func (self *stubACMEServer) getOrder(id string) *stubACMEOrder {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+
+	if index, err := strconv.Atoi(id); (err == nil) && (index >= 0) && (index < len(self.orders)) {
+		order := self.orders[index]
+		if order.Status == acme.StatusPending {
+			switch order.authorization.Status {
+			case acme.StatusValid:
+				order.Status = acme.StatusReady
+				order.Finalize = self.url("/finalize/%d", index)
+
+			case acme.StatusInvalid:
+				order.Status = acme.StatusInvalid
+			}
+		}
+		return order
+	}
+	return nil
+}
+
+func (self *stubACMEServer) getAuthorization(id string) *stubACMEAuthorization {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+
+	if index, err := strconv.Atoi(id); (err == nil) && (index >= 0) && (index < len(self.authorizations)) {
+		return self.authorizations[index]
+	}
+	return nil
+}
+
+func (self *stubACMEServer) validate(authorization *stubACMEAuthorization) error {
+	token := authorization.Challenges[0].Token
+
+	switch self.challengeType {
+	case "tls-alpn-01":
+		if self.TLSAddress == "" {
+			return errors.New("no TLS address")
+		}
+
+		conn, err := tls.Dial("tcp", self.TLSAddress, &tls.Config{
+			ServerName:         authorization.domain,
+			NextProtos:         []string{acme.ALPNProto},
+			InsecureSkipVerify: true,
+		})
+		if err != nil {
+			return err
+		}
+		defer conn.Close()
+
+		state := conn.ConnectionState()
+		if state.NegotiatedProtocol != acme.ALPNProto {
+			return fmt.Errorf("negotiated protocol is %q", state.NegotiatedProtocol)
+		}
+
+		certificate := state.PeerCertificates[0]
+		if err := certificate.VerifyHostname(authorization.domain); err != nil {
+			return err
+		}
+		for _, extension := range certificate.Extensions {
+			if extension.Id.Equal(acmeIdentifierOid) {
+				return nil
+			}
+		}
+		return errors.New("no acmeIdentifier extension")
+
+	case "http-01":
+		if self.HTTPAddress == "" {
+			return errors.New("no HTTP address")
+		}
+
+		client := http.Client{
+			Transport: &http.Transport{
+				DialContext: func(context contextpkg.Context, network string, address string) (net.Conn, error) {
+					return new(net.Dialer).DialContext(context, network, self.HTTPAddress)
+				},
+			},
+		}
+		defer client.CloseIdleConnections()
+
+		response, err := client.Get("http://" + authorization.domain + "/.well-known/acme-challenge/" + token)
+		if err != nil {
+			return err
+		}
+		defer response.Body.Close()
+
+		if response.StatusCode != http.StatusOK {
+			return fmt.Errorf("status: %d", response.StatusCode)
+		}
+		body, err := io.ReadAll(response.Body)
+		if err != nil {
+			return err
+		}
+		if !strings.HasPrefix(string(body), token+".") {
+			return fmt.Errorf("wrong key authorization: %q", body)
+		}
+		return nil
+
+	default:
+		return fmt.Errorf("unsupported challenge type: %s", self.challengeType)
+	}
+}
+
+func (self *stubACMEServer) issue(csr string) ([]byte, error) {
+	der, err := base64.RawURLEncoding.DecodeString(csr)
+	if err != nil {
+		return nil, err
+	}
+	request, err := x509.ParseCertificateRequest(der)
+	if err != nil {
+		return nil, err
+	}
+
+	// Long enough to not be renewed by autocert right away
+	template := x509.Certificate{
+		SerialNumber:          big.NewInt(int64(len(self.orders) + 1)),
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(90 * 24 * time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		DNSNames:              request.DNSNames,
+		BasicConstraintsValid: true,
+	}
+	return x509.CreateCertificate(rand.Reader, &template, self.rootCert, request.PublicKey, self.rootKey)
+}
+
+func (self *stubACMEServer) writeJSON(responseWriter http.ResponseWriter, status int, value any) {
+	responseWriter.Header().Set(HeaderContentType, "application/json")
+	responseWriter.WriteHeader(status)
+	if err := json.NewEncoder(responseWriter).Encode(value); err != nil {
+		self.t.Error(err)
+	}
+}
+
+// Decodes the payload of a flattened JWS without verifying its signature
+func decodeStubACMEPayload(reader io.Reader, payload any) error {
+	var jws struct{ Payload string }
+	if err := json.NewDecoder(reader).Decode(&jws); err != nil {
+		return err
+	}
+	if bytes, err := base64.RawURLEncoding.DecodeString(jws.Payload); err == nil {
+		return json.Unmarshal(bytes, payload)
+	} else {
+		return err
+	}
+}
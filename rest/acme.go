@@ -0,0 +1,113 @@
+package rest
+
+import (
+	contextpkg "context"
+	"crypto/tls"
+	"errors"
+	"net/http"
+
+	"github.com/tliron/commonlog"
+	"github.com/tliron/go-ard"
+	"github.com/tliron/prudence/platform"
+	"golang.org/x/crypto/acme"
+	"golang.org/x/crypto/acme/autocert"
+)
+
+//
+// ACME
+//
+// Automatic certificate management via the ACME protocol (e.g. Let's Encrypt).
+// Certificates are obtained on demand during the TLS handshake and renewed
+// before they expire.
+//
+// The TLS-ALPN-01 challenge is always supported on the server's own listener.
+// The HTTP-01 challenge additionally requires a plain HTTP listener, which will
+// be started if ChallengeAddress is set (it should usually be ":80").
+//
+
+type ACME struct {
+	Hosts            []string
+	Email            string
+	DirectoryURL     string // empty for Let's Encrypt production
+	CacheDirectory   string // empty for no on-disk cache
+	ChallengeAddress string // empty to disable the HTTP-01 challenge listener
+
+	manager         *autocert.Manager
+	challengeServer *http.Server
+}
+
+func NewACME() *ACME {
+	return &ACME{
+		DirectoryURL: autocert.DefaultACMEDirectory,
+	}
+}
+
+func CreateACME(config *ard.Node) (*ACME, error) {
+	self := NewACME()
+
+	self.Hosts = platform.AsStringList(config.Get("hosts"))
+	if len(self.Hosts) == 0 {
+		return nil, errors.New("Server \"tls.acme\" must have \"hosts\"")
+	}
+
+	self.Email, _ = config.Get("email").String()
+
+	if directoryUrl, ok := config.Get("directory").String(); ok {
+		self.DirectoryURL = directoryUrl
+	}
+
+	self.CacheDirectory, _ = config.Get("cache").String()
+	self.ChallengeAddress, _ = config.Get("challengeAddress").String()
+
+	return self, nil
+}
+
+func (self *ACME) NewTLSConfig() *tls.Config {
+	self.manager = &autocert.Manager{
+		Prompt:     autocert.AcceptTOS,
+		HostPolicy: autocert.HostWhitelist(self.Hosts...),
+		Email:      self.Email,
+		Client: &acme.Client{
+			DirectoryURL: self.DirectoryURL,
+		},
+	}
+
+	if self.CacheDirectory != "" {
+		self.manager.Cache = autocert.DirCache(self.CacheDirectory)
+	}
+
+	// Includes the "acme-tls/1" protocol for the TLS-ALPN-01 challenge
+	return self.manager.TLSConfig()
+}
+
+func (self *ACME) StartChallengeServer(log commonlog.Logger) {
+	if (self.ChallengeAddress == "") || (self.manager == nil) {
+		return
+	}
+
+	log = commonlog.NewKeyValueLogger(log, "_scope", "acme", "address", self.ChallengeAddress)
+
+	// Requests that are not challenges will be redirected to HTTPS
+	self.challengeServer = &http.Server{
+		Addr:              self.ChallengeAddress,
+		ReadHeaderTimeout: DEFAULT_READ_HEADER_TIMEOUT,
+		Handler:           self.manager.HTTPHandler(nil),
+	}
+
+	go func() {
+		log.Info("starting HTTP-01 challenge listener")
+		if err := self.challengeServer.ListenAndServe(); (err != nil) && (err != http.ErrServerClosed) {
+			log.Error(err.Error())
+		}
+	}()
+}
+
+func (self *ACME) StopChallengeServer(stopContext contextpkg.Context) error {
+	if self.challengeServer != nil {
+		err := self.challengeServer.Shutdown(stopContext)
+		self.challengeServer = nil
+		return err
+	} else {
+		return nil
+	}
+}
@@ -0,0 +1,109 @@
+package rest
+
+import (
+	contextpkg "context"
+	"crypto/tls"
+	"io"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/tliron/commonlog"
+)
+
+const testACMEHost = "prudence.test"
+
+func TestACMETLSALPN01(t *testing.T) {
+	testACME(t, "tls-alpn-01")
+}
+
+func TestACMEHTTP01(t *testing.T) {
+	testACME(t, "http-01")
+}
+
+func testACME(t *testing.T, challengeType string) {
+	ca := newStubACMEServer(t, challengeType)
+
+	acme := NewACME()
+	acme.Hosts = []string{testACMEHost}
+	acme.DirectoryURL = ca.URL()
+
+	listener, err := tls.Listen("tcp", "127.0.0.1:0", acme.NewTLSConfig())
+	if err != nil {
+		t.Fatal(err)
+	}
+	ca.TLSAddress = listener.Addr().String()
+
+	server := http.Server{
+		Handler: http.HandlerFunc(func(responseWriter http.ResponseWriter, request *http.Request) {
+			io.WriteString(responseWriter, "ok")
+		}),
+	}
+	go server.Serve(listener)
+	defer server.Close()
+
+	if challengeType == "http-01" {
+		acme.ChallengeAddress = freeTestAddress(t)
+		acme.StartChallengeServer(commonlog.GetLogger("prudence.test"))
+		defer acme.StopChallengeServer(contextpkg.Background())
+		ca.HTTPAddress = acme.ChallengeAddress
+		waitForTestAddress(t, acme.ChallengeAddress)
+	}
+
+	// The first handshake for the host obtains the certificate
+	client := http.Client{
+		Transport: &http.Transport{
+			DialContext: func(context contextpkg.Context, network string, address string) (net.Conn, error) {
+				return new(net.Dialer).DialContext(context, network, ca.TLSAddress)
+			},
+			TLSClientConfig: &tls.Config{
+				RootCAs: ca.Roots,
+			},
+		},
+		Timeout: 30 * time.Second,
+	}
+	defer client.CloseIdleConnections()
+
+	response, err := client.Get("https://" + testACMEHost + "/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer response.Body.Close()
+
+	if body, err := io.ReadAll(response.Body); err != nil {
+		t.Fatal(err)
+	} else if string(body) != "ok" {
+		t.Errorf("wrong body: %q", body)
+	}
+
+	certificate := response.TLS.PeerCertificates[0]
+	if err := certificate.VerifyHostname(testACMEHost); err != nil {
+		t.Error(err)
+	}
+	if len(certificate.DNSNames) != 1 {
+		t.Errorf("expected a single DNS name, got %v", certificate.DNSNames)
+	}
+}
+
+func freeTestAddress(t *testing.T) string {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	return listener.Addr().String()
+}
+
+func waitForTestAddress(t *testing.T, address string) {
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		if conn, err := net.Dial("tcp", address); err == nil {
+			conn.Close()
+			return
+		} else if time.Now().After(deadline) {
+			t.Fatal(err)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
@@ -0,0 +1,115 @@
+package rest
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/tliron/commonjs-goja"
+	"github.com/tliron/go-ard"
+	"github.com/tliron/prudence/platform"
+)
+
+//
+// CacheAdmin
+//
+// Serves cache statistics and contents as JSON:
+//
+//	GET    stats                       statistics
+//	DELETE stats                       resets the statistics
+//	GET    entries?prefix=&group=&limit=
+//	DELETE entries?key=                deletes a representation
+//	GET    groups                      keys per group
+//	DELETE groups?name=                deletes a group
+//
+// Paths are relative to the route (use a "*" path template). Note that this
+// handler does not do any access control.
+//
+
+type CacheAdmin struct {
+	ReadOnly bool
+}
+
+func NewCacheAdmin() *CacheAdmin {
+	return new(CacheAdmin)
+}
+
+// ([platform.CreateFunc] signature)
+func CreateCacheAdmin(jsContext *commonjs.Context, config ard.StringMap) (any, error) {
+	config_ := ard.With(config).ConvertSimilar().NilMeansZero()
+
+	self := NewCacheAdmin()
+	self.ReadOnly, _ = config_.Get("readOnly").Boolean()
+
+	return self, nil
+}
+
+// ([Handler] interface, [HandleFunc] signature)
+func (self *CacheAdmin) Handle(restContext *Context) (bool, error) {
+	path := strings.Trim(restContext.Request.Path, "/")
+	query := restContext.Request.Query
+
+	var value any
+	switch restContext.Request.Method {
+	case "GET", "HEAD":
+		switch path {
+		case "", "stats":
+			value = platform.GetCacheStats()
+
+		case "entries":
+			limit, _ := strconv.Atoi(query.Get("limit"))
+			value = platform.ListCacheEntries(query.Get("prefix"), platform.CacheKey(query.Get("group")), limit)
+
+		case "groups":
+			value = platform.ListCacheGroups()
+
+		default:
+			return false, nil
+		}
+
+	case "DELETE":
+		if self.ReadOnly {
+			restContext.Response.Status = http.StatusMethodNotAllowed // 405
+			return true, nil
+		}
+
+		switch path {
+		case "stats":
+			platform.ResetCacheStats()
+			value = ard.StringMap{"reset": true}
+
+		case "entries":
+			key := query.Get("key")
+			if key == "" {
+				restContext.Response.Status = http.StatusBadRequest // 400
+				return true, nil
+			}
+			if cacheBackend := platform.GetCacheBackend(); cacheBackend != nil {
+				cacheBackend.DeleteRepresentation(platform.CacheKey(key))
+			}
+			restContext.Log.Infof("deleted cache key: %s", key)
+			value = ard.StringMap{"deleted": key}
+
+		case "groups":
+			name := query.Get("name")
+			if name == "" {
+				restContext.Response.Status = http.StatusBadRequest // 400
+				return true, nil
+			}
+			platform.InvalidateCacheGroup(platform.CacheKey(name))
+			restContext.Log.Infof("deleted cache group: %s", name)
+			value = ard.StringMap{"deleted": name}
+
+		default:
+			return false, nil
+		}
+
+	default:
+		restContext.Response.Status = http.StatusMethodNotAllowed // 405
+		return true, nil
+	}
+
+	restContext.Response.Header.Set(HeaderCacheControl, "no-store")
+	SetContentTypeHeader(restContext.Response.Header, "application/json", "utf-8")
+	return true, restContext.Transcribe(value, "json", "  ")
+}
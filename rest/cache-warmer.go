@@ -0,0 +1,412 @@
+package rest
+
+import (
+	"bytes"
+	contextpkg "context"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"net/http"
+	urlpkg "net/url"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/tliron/commonjs-goja"
+	"github.com/tliron/go-ard"
+	"github.com/tliron/prudence/platform"
+)
+
+const MAX_SITEMAP_DEPTH = 3
+
+var DefaultWarmAcceptEncodings = []string{"identity", "gzip", "br", "zstd", "deflate"}
+
+//
+// CacheWarmer
+//
+// Populates the cache by sending internal requests directly to a server's
+// handler (no network is involved). Each URL is requested once for every
+// combination of Accept and Accept-Encoding.
+//
+// Accept must be set, usually to the content types of the representations,
+// otherwise only the default representation will be warmed.
+//
+
+type CacheWarmer struct {
+	Server          *Server
+	URLs            []string
+	Sitemaps        []string // URLs of sitemaps or sitemap indexes, also requested internally
+	Generate        func() ([]string, error)
+	Accept          []string // required; empty string means no header
+	AcceptEncodings []string // empty string means no header
+	Host            string   // for URLs without a host
+	Concurrency     int
+	Schedule        string // cron pattern
+	OnStart         bool
+
+	started   bool
+	scheduled bool // schedulers cannot unschedule, so we schedule only once
+	startLock sync.Mutex
+	stopped   atomic.Bool
+}
+
+func NewCacheWarmer(server *Server) *CacheWarmer {
+	return &CacheWarmer{
+		Server:          server,
+		AcceptEncodings: DefaultWarmAcceptEncodings,
+		Host:            "localhost",
+		Concurrency:     4,
+	}
+}
+
+// ([platform.CreateFunc] signature)
+func CreateCacheWarmer(jsContext *commonjs.Context, config ard.StringMap) (any, error) {
+	config_ := ard.With(config).ConvertSimilar().NilMeansZero()
+
+	var server *Server
+	if server_ := config_.Get("server").Value; server_ != nil {
+		var ok bool
+		if server, ok = server_.(*Server); !ok {
+			return nil, fmt.Errorf("CacheWarmer \"server\" is not a Server: %T", server_)
+		}
+	} else if handler := config_.Get("handler").Value; handler != nil {
+		// A server that is never started
+		server = NewServer("")
+		var err error
+		if server.Handler, err = GetHandleFunc(handler, jsContext); err != nil {
+			return nil, err
+		}
+	} else {
+		return nil, errors.New("CacheWarmer must have either \"server\" or \"handler\"")
+	}
+
+	self := NewCacheWarmer(server)
+
+	self.URLs = platform.AsStringList(config_.Get("urls"))
+	self.Sitemaps = platform.AsStringList(config_.Get("sitemaps"))
+
+	if generate := config_.Get("generate").Value; generate != nil {
+		var err error
+		if generate, jsContext, err = commonjs.Unbind(generate, jsContext); err != nil {
+			return nil, err
+		}
+
+		self.Generate = func() ([]string, error) {
+			if urls, err := jsContext.Environment.Call(generate, nil); err == nil {
+				return platform.AsStringList(ard.With(urls).ConvertSimilar()), nil
+			} else {
+				return nil, err
+			}
+		}
+	}
+
+	if accept := config_.Get("accept"); accept.Value != nil {
+		self.Accept = platform.AsStringList(accept)
+	} else {
+		return nil, errors.New("CacheWarmer must have \"accept\", e.g. the content types of your representations (use \"\" to send no header)")
+	}
+	if acceptEncodings := config_.Get("acceptEncodings"); acceptEncodings.Value != nil {
+		self.AcceptEncodings = platform.AsStringList(acceptEncodings)
+	}
+	if host, ok := config_.Get("host").String(); ok {
+		self.Host = host
+	}
+	if concurrency, ok := config_.Get("concurrency").UnsignedInteger(); ok && (concurrency > 0) {
+		self.Concurrency = int(concurrency)
+	}
+	self.Schedule, _ = config_.Get("schedule").String()
+	self.OnStart, _ = config_.Get("onStart").Boolean()
+
+	return self, nil
+}
+
+// ([platform.Startable] interface)
+func (self *CacheWarmer) Start() error {
+	self.startLock.Lock()
+
+	if self.started {
+		self.startLock.Unlock()
+		return nil
+	}
+
+	if (self.Schedule != "") && !self.scheduled {
+		if scheduler := platform.GetScheduler(); scheduler != nil {
+			if err := scheduler.Schedule(self.Schedule, self.job); err != nil {
+				self.startLock.Unlock()
+				return err
+			}
+			self.scheduled = true
+		} else {
+			self.startLock.Unlock()
+			return errors.New("CacheWarmer has a \"schedule\" but there is no scheduler")
+		}
+	}
+
+	self.started = true
+	self.stopped.Store(false)
+	self.startLock.Unlock()
+
+	if self.OnStart {
+		self.job()
+	}
+
+	return nil
+}
+
+// ([platform.Startable] interface)
+func (self *CacheWarmer) Stop(stopContext contextpkg.Context) error {
+	self.startLock.Lock()
+	defer self.startLock.Unlock()
+
+	// Schedulers cannot unschedule, so we will just ignore future jobs until
+	// we are started again
+	self.started = false
+	self.stopped.Store(true)
+	return nil
+}
+
+// Returns the number of requests sent.
+func (self *CacheWarmer) Warm() (int, error) {
+	if len(self.Accept) == 0 {
+		return 0, errors.New("CacheWarmer has no \"accept\"")
+	}
+
+	urls, err := self.GetURLs()
+	if err != nil {
+		return 0, err
+	}
+
+	type variant struct {
+		url            string
+		accept         string
+		acceptEncoding string
+	}
+
+	variants := make(chan variant)
+	var count atomic.Int64
+	var wait sync.WaitGroup
+
+	start := time.Now()
+
+	for worker := 0; worker < self.Concurrency; worker++ {
+		wait.Add(1)
+		go func() {
+			defer wait.Done()
+			for variant := range variants {
+				if _, err := self.Request(variant.url, variant.accept, variant.acceptEncoding); err == nil {
+					count.Add(1)
+				} else {
+					log.Warningf("cache warmer: %s", err.Error())
+				}
+			}
+		}()
+	}
+
+urls:
+	for _, url := range urls {
+		for _, accept := range self.Accept {
+			for _, acceptEncoding := range self.AcceptEncodings {
+				if self.stopped.Load() {
+					break urls
+				}
+				variants <- variant{url, accept, acceptEncoding}
+			}
+		}
+	}
+
+	close(variants)
+	wait.Wait()
+
+	log.Infof("cache warmer: %d URLs, %d requests, %s", len(urls), count.Load(), time.Since(start))
+
+	return int(count.Load()), nil
+}
+
+// Combines URLs, URLs in sitemaps, and generated URLs, without duplicates.
+func (self *CacheWarmer) GetURLs() ([]string, error) {
+	var urls []string
+	known := make(map[string]struct{})
+
+	add := func(urls_ []string) {
+		for _, url := range urls_ {
+			if _, ok := known[url]; !ok {
+				known[url] = struct{}{}
+				urls = append(urls, url)
+			}
+		}
+	}
+
+	add(self.URLs)
+
+	for _, sitemap := range self.Sitemaps {
+		if urls_, err := self.readSitemap(sitemap, 0); err == nil {
+			add(urls_)
+		} else {
+			return nil, err
+		}
+	}
+
+	if self.Generate != nil {
+		if urls_, err := self.Generate(); err == nil {
+			add(urls_)
+		} else {
+			return nil, err
+		}
+	}
+
+	return urls, nil
+}
+
+// Sends an internal GET request. Returns the response.
+func (self *CacheWarmer) Request(url string, accept string, acceptEncoding string) (*BufferResponseWriter, error) {
+	request, err := self.newRequest(url)
+	if err != nil {
+		return nil, err
+	}
+
+	if accept != "" {
+		request.Header.Set(HeaderAccept, accept)
+	}
+	if acceptEncoding != "" {
+		request.Header.Set(HeaderAcceptEncoding, acceptEncoding)
+	}
+
+	responseWriter := NewBufferResponseWriter()
+
+	if err := self.serve(responseWriter, request); err != nil {
+		return nil, err
+	}
+
+	if responseWriter.Status >= 400 {
+		return responseWriter, fmt.Errorf("status %d: %s", responseWriter.Status, url)
+	}
+
+	return responseWriter, nil
+}
+
+func (self *CacheWarmer) job() {
+	if !self.stopped.Load() {
+		if _, err := self.Warm(); err != nil {
+			log.Errorf("cache warmer: %s", err.Error())
+		}
+	}
+}
+
+func (self *CacheWarmer) newRequest(url string) (*http.Request, error) {
+	url_, err := urlpkg.Parse(url)
+	if err != nil {
+		return nil, err
+	}
+
+	if url_.Scheme == "" {
+		url_.Scheme = "http"
+	}
+	if url_.Host == "" {
+		url_.Host = self.Host
+	}
+	if !strings.HasPrefix(url_.Path, "/") {
+		url_.Path = "/" + url_.Path
+	}
+
+	request, err := http.NewRequest("GET", url_.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	request.RequestURI = url_.RequestURI()
+	request.RemoteAddr = "127.0.0.1:0"
+	request.Header.Set("User-Agent", "Prudence cache warmer")
+
+	return request, nil
+}
+
+func (self *CacheWarmer) serve(responseWriter http.ResponseWriter, request *http.Request) (err error) {
+	// Don't let a failed request stop the others
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic: %v: %s", r, request.URL.String())
+		}
+	}()
+
+	self.Server.ServeHTTP(responseWriter, request)
+	return nil
+}
+
+func (self *CacheWarmer) readSitemap(url string, depth int) ([]string, error) {
+	if depth > MAX_SITEMAP_DEPTH {
+		return nil, fmt.Errorf("sitemap index is nested too deeply: %s", url)
+	}
+
+	responseWriter, err := self.Request(url, "", "")
+	if err != nil {
+		return nil, err
+	}
+
+	// Supports both <urlset> and <sitemapindex>
+	// See: https://www.sitemaps.org/protocol.html
+	var sitemap struct {
+		URLs []struct {
+			Loc string `xml:"loc"`
+		} `xml:"url"`
+		Sitemaps []struct {
+			Loc string `xml:"loc"`
+		} `xml:"sitemap"`
+	}
+
+	if err := xml.Unmarshal(responseWriter.Body.Bytes(), &sitemap); err != nil {
+		return nil, fmt.Errorf("malformed sitemap: %s: %w", url, err)
+	}
+
+	var urls []string
+	for _, url_ := range sitemap.URLs {
+		if loc := strings.TrimSpace(url_.Loc); loc != "" {
+			urls = append(urls, loc)
+		}
+	}
+
+	for _, sitemap_ := range sitemap.Sitemaps {
+		if loc := strings.TrimSpace(sitemap_.Loc); loc != "" {
+			if urls_, err := self.readSitemap(loc, depth+1); err == nil {
+				urls = append(urls, urls_...)
+			} else {
+				return nil, err
+			}
+		}
+	}
+
+	return urls, nil
+}
+
+//
+// BufferResponseWriter
+//
+
+type BufferResponseWriter struct {
+	Status int
+	Body   bytes.Buffer
+
+	header http.Header
+}
+
+func NewBufferResponseWriter() *BufferResponseWriter {
+	return &BufferResponseWriter{
+		Status: http.StatusOK,
+		header: make(http.Header),
+	}
+}
+
+// ([http.ResponseWriter] interface)
+func (self *BufferResponseWriter) Header() http.Header {
+	return self.header
+}
+
+// ([http.ResponseWriter] interface)
+func (self *BufferResponseWriter) Write(p []byte) (int, error) {
+	return self.Body.Write(p)
+}
+
+// ([http.ResponseWriter] interface)
+func (self *BufferResponseWriter) WriteHeader(statusCode int) {
+	self.Status = statusCode
+}
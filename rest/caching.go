@@ -2,15 +2,51 @@ package rest
 
 import (
 	"bytes"
+	contextpkg "context"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"net/http"
+	"sort"
 	"strconv"
+	"sync"
 	"time"
 
+	"github.com/tliron/commonlog"
 	"github.com/tliron/go-ard"
+	"github.com/tliron/go-scriptlet/jst"
 	"github.com/tliron/prudence/platform"
 )
 
 func (self *Context) NewCacheKey() platform.CacheKey {
-	return platform.CacheKey(self.CacheKey + platform.CACHE_KEY_SEPARATOR + self.Response.ContentType + platform.CACHE_KEY_SEPARATOR + self.Response.CharSet + platform.CACHE_KEY_SEPARATOR + self.Response.Language)
+	key := self.CacheKey + platform.CACHE_KEY_SEPARATOR + self.Response.ContentType + platform.CACHE_KEY_SEPARATOR + self.Response.CharSet + platform.CACHE_KEY_SEPARATOR + self.Response.Language
+	if len(self.CacheVary) > 0 {
+		key += platform.CACHE_KEY_SEPARATOR + self.hashVary()
+	}
+	return platform.CacheKey(key)
+}
+
+// We hash the header values so that sensitive ones (e.g. "Authorization") will
+// not appear in cache keys, which are logged and possibly shared with other nodes.
+func (self *Context) hashVary() string {
+	names := make([]string, len(self.CacheVary))
+	for index, name := range self.CacheVary {
+		names[index] = http.CanonicalHeaderKey(name)
+	}
+	sort.Strings(names)
+
+	hash := sha256.New()
+	for _, name := range names {
+		io.WriteString(hash, name)
+		hash.Write([]byte{0})
+		for _, value := range self.Request.Header.Values(name) {
+			io.WriteString(hash, value)
+			hash.Write([]byte{0})
+		}
+		hash.Write([]byte{1})
+	}
+
+	return hex.EncodeToString(hash.Sum(nil))
 }
 
 func (self *Context) NewCachedRepresentation(withBody bool) *platform.CachedRepresentation {
@@ -19,7 +55,9 @@ func (self *Context) NewCachedRepresentation(withBody bool) *platform.CachedRepr
 	if withBody {
 		contentEncoding := self.Response.Header.Get(HeaderContentEncoding)
 		if encoding := platform.GetEncodingFromHeader(contentEncoding); encoding != platform.EncodingTypeUnsupported {
-			body[encoding] = self.Response.Buffer.Bytes()
+			if body_, ok := self.Response.body(); ok {
+				body[encoding] = body_
+			}
 		} else {
 			self.Log.Warningf("unsupported encoding: %s", contentEncoding)
 		}
@@ -28,8 +66,8 @@ func (self *Context) NewCachedRepresentation(withBody bool) *platform.CachedRepr
 	headers := make(map[string][]string)
 	for name, values := range self.Response.Header {
 		switch name {
-		case HeaderCacheControl, HeaderServer, HeaderPrudenceCached:
-			// Skip
+		case HeaderCacheControl, HeaderServer, HeaderPrudenceCached, HeaderSetCookie:
+			// Skip (cookies are for the client who caused them to be set)
 		default:
 			headers[name] = ard.Copy(values).([]string)
 		}
@@ -45,6 +83,9 @@ func (self *Context) NewCachedRepresentation(withBody bool) *platform.CachedRepr
 		Body:       body,
 		Headers:    headers,
 		Expiration: time.Now().Add(time.Duration(self.CacheDuration * float64(time.Second))),
+
+		StaleWhileRevalidate: time.Duration(self.StaleWhileRevalidate * float64(time.Second)),
+		StaleIfError:         time.Duration(self.StaleIfError * float64(time.Second)),
 	}
 }
 
@@ -59,6 +100,9 @@ func (self *Context) NewCachedRepresentationFromBody(encoding platform.EncodingT
 		Body:       map[platform.EncodingType][]byte{encoding: body},
 		Headers:    nil,
 		Expiration: time.Now().Add(time.Duration(self.CacheDuration * float64(time.Second))),
+
+		StaleWhileRevalidate: time.Duration(self.StaleWhileRevalidate * float64(time.Second)),
+		StaleIfError:         time.Duration(self.StaleIfError * float64(time.Second)),
 	}
 }
 
@@ -66,6 +110,7 @@ func (self *Context) LoadCachedRepresentation() (platform.CacheKey, *platform.Ca
 	if cacheBackend := platform.GetCacheBackend(); cacheBackend != nil {
 		key := self.NewCacheKey()
 		if cached, ok := cacheBackend.LoadRepresentation(key); ok {
+			platform.CountCacheHit(cached.Groups)
 			self.Log.Debug("hit",
 				"_scope", "cache",
 				"key", key,
@@ -73,6 +118,7 @@ func (self *Context) LoadCachedRepresentation() (platform.CacheKey, *platform.Ca
 			)
 			return key, cached, true
 		} else {
+			platform.CountCacheMiss()
 			self.Log.Debug("miss",
 				"_scope", "cache",
 				"key", key,
@@ -96,10 +142,19 @@ func (self *Context) DeleteCachedRepresentation() {
 }
 
 func (self *Context) StoreCachedRepresentation(withBody bool) {
+	if withBody && self.Response.streaming && (self.Response.streamed == nil) {
+		self.Log.Debug("not storing because streaming started before caching was enabled",
+			"_scope", "cache",
+		)
+		return
+	}
+
 	if cacheBackend := platform.GetCacheBackend(); cacheBackend != nil {
 		key := self.NewCacheKey()
 		cached := self.NewCachedRepresentation(withBody)
+		self.stored = cached.Copy() // the cache backend might share the original
 		cacheBackend.StoreRepresentation(key, cached)
+		platform.CountCacheStore(cached.Groups)
 		self.Log.Debug("stored",
 			"_scope", "cache",
 			"key", key,
@@ -112,7 +167,9 @@ func (self *Context) StoreCachedRepresentationFromBody(encoding platform.Encodin
 	if cacheBackend := platform.GetCacheBackend(); cacheBackend != nil {
 		key := self.NewCacheKey()
 		cached := self.NewCachedRepresentationFromBody(encoding, body)
+		self.stored = cached.Copy() // the cache backend might share the original
 		cacheBackend.StoreRepresentation(key, cached)
+		platform.CountCacheStore(cached.Groups)
 		self.Log.Debug("stored",
 			"_scope", "cache",
 			"key", key,
@@ -124,7 +181,17 @@ func (self *Context) StoreCachedRepresentationFromBody(encoding platform.Encodin
 func (self *Context) GetCachedRepresentationBody(cached *platform.CachedRepresentation) ([]byte, platform.EncodingType, bool) {
 	encodingPreferences := ParseEncodingPreferences(self.Request.Header.Get(HeaderAcceptEncoding))
 	encoding := encodingPreferences.NegotiateBest(self)
-	if body, changed := cached.GetBody(encoding); body != nil {
+
+	if (encoding != platform.EncodingTypeIdentity) && (encoding != platform.EncodingTypeUnsupported) && !encodingPreferences.ForbidIdentity() {
+		// Don't encode if we wouldn't have encoded it when rendering
+		if body, ok := cached.Body[platform.EncodingTypeIdentity]; ok {
+			if !self.Compression.ShouldEncode(http.Header(cached.Headers).Get(HeaderContentType), len(body)) {
+				encoding = platform.EncodingTypeIdentity
+			}
+		}
+	}
+
+	if body, changed := cached.GetBodyLevel(encoding, self.Compression.Level(encoding)); body != nil {
 		return body, encoding, changed
 	} else {
 		return nil, platform.EncodingTypeUnsupported, false
@@ -152,8 +219,7 @@ func (self *Context) PresentCachedRepresentation(cached *platform.CachedRepresen
 	}
 
 	// Match client-side caching with server-side caching
-	maxAge := int64(cached.TimeToLive())
-	self.Response.Header.Set(HeaderCacheControl, "max-age="+strconv.FormatInt(maxAge, 10))
+	self.Response.Header.Set(HeaderCacheControl, cacheControl(cached.TimeToLive(), remainingStale(cached, cached.StaleWhileRevalidate), remainingStale(cached, cached.StaleIfError)))
 
 	if withBody {
 		body, encoding, changed := self.GetCachedRepresentationBody(cached)
@@ -185,3 +251,141 @@ func (self *Context) UpdateCachedRepresentation(key platform.CacheKey, cached *p
 		)
 	}
 }
+
+// Creates a context for regenerating a stale cached representation in the
+// background. It does not share any mutable state with this context and its
+// response is discarded (except for storing it in the cache).
+func (self *Context) NewRevalidationContext() *Context {
+	request := self.Request.Clone()
+	// We always want the full representation
+	request.Header.Del(HeaderIfNoneMatch)
+	request.Header.Del(HeaderIfModifiedSince)
+
+	response := NewResponse(discardResponseWriter{})
+	response.ContentType = self.Response.ContentType
+	response.CharSet = self.Response.CharSet
+	response.Language = self.Response.Language
+
+	context := jst.NewContext(response.Buffer, nil)
+	context.Variables = ard.Copy(self.Variables).(map[string]any)
+
+	return &Context{
+		Context:      context,
+		Id:           self.Id,
+		Request:      request,
+		Response:     response,
+		Name:         self.Name,
+		Log:          commonlog.NewKeyValueLogger(self.Log, "_scope", "revalidate"),
+		Debug:        self.Debug,
+		revalidating: true,
+
+		SurrogateKeyHeaders: self.SurrogateKeyHeaders,
+		Compression:         self.Compression,
+		Timeout:             self.Timeout,
+	}
+}
+
+var revalidations sync.Map // platform.CacheKey to struct{}
+
+// Calls render in the background with a new revalidation context (see
+// [Context.NewRevalidationContext]), which is expected to store a fresh
+// representation in the cache. Only one revalidation per cache key will run at
+// a time.
+//
+// The revalidation context is not canceled when this request ends, but it
+// does have a deadline (the handler timeout or [DEFAULT_HANDLER_TIMEOUT]).
+// Once the deadline passes the cache key can be revalidated again, even if
+// render has not returned.
+func (self *Context) revalidate(key platform.CacheKey, render func(restContext *Context) error) {
+	if _, running := revalidations.LoadOrStore(key, struct{}{}); running {
+		return
+	}
+
+	timeout := self.Timeout
+	if timeout <= 0 {
+		timeout = DEFAULT_HANDLER_TIMEOUT
+	}
+
+	restContext := self.NewRevalidationContext()
+	restContext.Log.Debug("revalidating", "key", key)
+
+	context, cancel := contextpkg.WithTimeout(contextpkg.WithoutCancel(restContext.Request.Direct.Context()), timeout)
+	restContext.Request.Direct = restContext.Request.Direct.WithContext(context)
+
+	done := make(chan struct{})
+
+	go func() {
+		defer close(done)
+
+		defer func() {
+			if r := recover(); r != nil {
+				if r == EndRequest {
+					restContext.Log.Debug("end")
+				} else {
+					restContext.Log.Errorf("panic: %v", r)
+				}
+			}
+		}()
+
+		if err := render(restContext); err != nil {
+			restContext.Log.Error(err.Error())
+		}
+	}()
+
+	go func() {
+		defer revalidations.Delete(key)
+		defer cancel()
+
+		select {
+		case <-done:
+		case <-context.Done():
+			restContext.Log.Warning("revalidation timed out", "key", key)
+		}
+	}()
+}
+
+// Cache-Control header value with optional RFC 5861 extensions (all arguments
+// are in seconds)
+func cacheControl(maxAge float64, staleWhileRevalidate float64, staleIfError float64) string {
+	cacheControl := "max-age=" + strconv.FormatInt(int64(maxAge), 10)
+	if staleWhileRevalidate >= 1.0 {
+		cacheControl += ",stale-while-revalidate=" + strconv.FormatInt(int64(staleWhileRevalidate), 10)
+	}
+	if staleIfError >= 1.0 {
+		cacheControl += ",stale-if-error=" + strconv.FormatInt(int64(staleIfError), 10)
+	}
+	return cacheControl
+}
+
+// How much of the stale period is left after expiration (in seconds)
+func remainingStale(cached *platform.CachedRepresentation, stale time.Duration) float64 {
+	from := cached.Expiration
+	if now := time.Now(); now.After(from) {
+		from = now
+	}
+	if remaining := cached.Expiration.Add(stale).Sub(from).Seconds(); remaining > 0.0 {
+		return remaining
+	} else {
+		return 0.0
+	}
+}
+
+//
+// discardResponseWriter
+//
+
+type discardResponseWriter struct{}
+
+// ([http.ResponseWriter] interface)
+func (self discardResponseWriter) Header() http.Header {
+	return make(http.Header)
+}
+
+// ([http.ResponseWriter] interface)
+func (self discardResponseWriter) Write(p []byte) (int, error) {
+	return len(p), nil
+}
+
+// ([http.ResponseWriter] interface)
+func (self discardResponseWriter) WriteHeader(statusCode int) {
+}
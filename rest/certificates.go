@@ -0,0 +1,207 @@
+package rest
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/tliron/commonlog"
+	"github.com/tliron/exturl"
+	"github.com/tliron/kutil/fswatch"
+)
+
+//
+// CertificateFiles
+//
+
+type CertificateFiles struct {
+	Certificate string // path to PEM
+	Key         string // path to PEM
+}
+
+//
+// CertificateStore
+//
+// Holds several certificates, choosing between them according to SNI
+// (Server Name Indication), and optionally a CA bundle for verifying client
+// certificates. Files can be watched and reloaded when they change on disk.
+//
+
+type CertificateStore struct {
+	Files        []CertificateFiles
+	Static       []tls.Certificate // not reloadable
+	ClientCAFile string            // path to PEM bundle
+
+	certificates []tls.Certificate
+	clientCAs    *x509.CertPool
+	lock         sync.RWMutex
+	watcher      *fswatch.Watcher
+	urlContext   *exturl.Context
+	log          commonlog.Logger
+}
+
+func NewCertificateStore(log commonlog.Logger) *CertificateStore {
+	return &CertificateStore{
+		log: log,
+	}
+}
+
+func (self *CertificateStore) Load() error {
+	certificates := append(self.Static[:0:0], self.Static...)
+
+	for _, files := range self.Files {
+		if certificate, err := tls.LoadX509KeyPair(files.Certificate, files.Key); err == nil {
+			// Parse the leaf in advance so that SNI selection won't have to
+			if certificate.Leaf, err = x509.ParseCertificate(certificate.Certificate[0]); err != nil {
+				return err
+			}
+			certificates = append(certificates, certificate)
+		} else {
+			return fmt.Errorf("%s, %s: %w", files.Certificate, files.Key, err)
+		}
+	}
+
+	var clientCAs *x509.CertPool
+	if self.ClientCAFile != "" {
+		if bundle, err := os.ReadFile(self.ClientCAFile); err == nil {
+			clientCAs = x509.NewCertPool()
+			if !clientCAs.AppendCertsFromPEM(bundle) {
+				return fmt.Errorf("no certificates in client CA bundle: %s", self.ClientCAFile)
+			}
+		} else {
+			return err
+		}
+	}
+
+	self.lock.Lock()
+	self.certificates = certificates
+	self.clientCAs = clientCAs
+	self.lock.Unlock()
+
+	return nil
+}
+
+// Watches the directories of all files so that we would also catch atomic
+// replacements via symlinks (as done by Kubernetes for mounted secrets).
+func (self *CertificateStore) StartWatching() error {
+	directories := make(map[string]struct{})
+	for _, files := range self.Files {
+		directories[filepath.Dir(files.Certificate)] = struct{}{}
+		directories[filepath.Dir(files.Key)] = struct{}{}
+	}
+	if self.ClientCAFile != "" {
+		directories[filepath.Dir(self.ClientCAFile)] = struct{}{}
+	}
+
+	if len(directories) == 0 {
+		return nil
+	}
+
+	self.urlContext = exturl.NewContext()
+
+	var err error
+	if self.watcher, err = fswatch.NewWatcher(self.urlContext); err != nil {
+		return err
+	}
+
+	for directory := range directories {
+		self.log.Infof("watching: %s", directory)
+		if err := self.watcher.Add(directory); err != nil {
+			self.StopWatching()
+			return err
+		}
+	}
+
+	self.watcher.Start(func(fileUrl *exturl.FileURL) {
+		self.log.Infof("reloading because changed: %s", fileUrl.Path)
+		if err := self.Load(); err != nil {
+			// Keep the previous certificates; we will try again on the next change
+			self.log.Errorf("could not reload: %s", err.Error())
+		}
+	})
+
+	return nil
+}
+
+func (self *CertificateStore) StopWatching() {
+	if self.watcher != nil {
+		commonlog.CallAndLogWarning(self.watcher.Close, "CertificateStore.StopWatching", self.log)
+		self.watcher = nil
+	}
+
+	if self.urlContext != nil {
+		commonlog.CallAndLogWarning(self.urlContext.Release, "CertificateStore.StopWatching", self.log)
+		self.urlContext = nil
+	}
+}
+
+func (self *CertificateStore) ClientCAs() *x509.CertPool {
+	self.lock.RLock()
+	defer self.lock.RUnlock()
+	return self.clientCAs
+}
+
+// ([tls.Config.GetCertificate] signature)
+func (self *CertificateStore) GetCertificate(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+	self.lock.RLock()
+	defer self.lock.RUnlock()
+
+	if len(self.certificates) == 0 {
+		return nil, errors.New("no TLS certificates")
+	}
+
+	if hello.ServerName != "" {
+		serverName := strings.ToLower(hello.ServerName)
+		for index := range self.certificates {
+			certificate := &self.certificates[index]
+			if certificate.Leaf != nil {
+				if certificate.Leaf.VerifyHostname(serverName) == nil {
+					return certificate, nil
+				}
+			}
+		}
+	}
+
+	// Fallback to the first certificate that the client can use
+	for index := range self.certificates {
+		certificate := &self.certificates[index]
+		if hello.SupportsCertificate(certificate) == nil {
+			return certificate, nil
+		}
+	}
+
+	return &self.certificates[0], nil
+}
+
+// ([tls.Config.GetConfigForClient] signature)
+func (self *CertificateStore) newGetConfigForClient(tlsConfig *tls.Config) func(hello *tls.ClientHelloInfo) (*tls.Config, error) {
+	return func(hello *tls.ClientHelloInfo) (*tls.Config, error) {
+		// Make sure to use the latest loaded CA bundle
+		tlsConfig_ := tlsConfig.Clone()
+		tlsConfig_.GetConfigForClient = nil
+		tlsConfig_.ClientCAs = self.ClientCAs()
+		return tlsConfig_, nil
+	}
+}
+
+func ParseClientAuth(clientAuth string) (tls.ClientAuthType, error) {
+	switch clientAuth {
+	case "", "none":
+		return tls.NoClientCert, nil
+	case "request":
+		return tls.RequestClientCert, nil
+	case "require":
+		return tls.RequireAnyClientCert, nil
+	case "verify":
+		return tls.VerifyClientCertIfGiven, nil
+	case "requireAndVerify":
+		return tls.RequireAndVerifyClientCert, nil
+	default:
+		return tls.NoClientCert, fmt.Errorf("unsupported client auth: %s", clientAuth)
+	}
+}
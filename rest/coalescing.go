@@ -0,0 +1,66 @@
+package rest
+
+import (
+	"time"
+
+	"github.com/tliron/prudence/platform"
+)
+
+const COALESCING_TIMEOUT = 30 * time.Second
+
+var flights = platform.NewFlights()
+
+// Calls render unless another request is already rendering the representation
+// for our cache key, in which case we wait for it and return the representation
+// it stored instead. If the cache backend is a [platform.CacheCoalescer] this
+// applies to requests on other nodes in the cluster, too.
+//
+// If waiting times out, or if the other request did not store a representation
+// (e.g. it failed), we will call render after all.
+//
+// Every waiter gets its own copy of the representation, because presenting it
+// might reencode its body.
+func (self *Context) Coalesce(withBody bool, render func() error) (*platform.CachedRepresentation, error) {
+	key := self.NewCacheKey()
+
+	accept := func(flight *platform.Flight) *platform.CachedRepresentation {
+		self.Log.Debug("waiting for render",
+			"_scope", "cache",
+			"key", key,
+		)
+		if cached, ok := flight.Wait(self.Request.Direct.Context(), COALESCING_TIMEOUT); ok && (cached != nil) {
+			if !withBody || (len(cached.Body) > 0) {
+				return cached.Copy()
+			}
+		}
+		return nil
+	}
+
+	flight, leader := flights.Join(key, time.Time{})
+	if !leader {
+		if cached := accept(flight); cached != nil {
+			return cached, nil
+		}
+		return nil, render()
+	}
+
+	self.stored = nil
+	defer func() {
+		// Also when render panics
+		flights.Land(key, self.stored)
+	}()
+
+	if coalescer, ok := platform.GetCacheBackend().(platform.CacheCoalescer); ok {
+		if flight := coalescer.JoinRendering(key); flight != nil {
+			if cached := accept(flight); cached != nil {
+				// Share it with our local waiters (we will be presenting our own copy)
+				self.stored = cached.Copy()
+				return cached, nil
+			}
+		} else {
+			defer coalescer.LeaveRendering(key)
+		}
+	}
+
+	return nil, render()
+}
@@ -12,16 +12,25 @@ const (
 	HeaderAccept          = "Accept"
 	HeaderAcceptEncoding  = "Accept-Encoding"
 	HeaderAcceptLanguage  = "Accept-Language"
+	HeaderAuthorization   = "Authorization"
 	HeaderCacheControl    = "Cache-Control"
+	HeaderCacheTag        = "Cache-Tag"
 	HeaderContentEncoding = "Content-Encoding"
 	HeaderContentType     = "Content-Type"
+	HeaderCookie          = "Cookie"
 	HeaderETag            = "ETag"
 	HeaderIfModifiedSince = "If-Modified-Since"
 	HeaderIfNoneMatch     = "If-None-Match"
+	HeaderLastEventID     = "Last-Event-ID"
 	HeaderLastModified    = "Last-Modified"
 	HeaderLocation        = "Location"
 	HeaderPrudenceCached  = "X-Prudence-Cached"
 	HeaderServer          = "Server"
+	HeaderSetCookie       = "Set-Cookie"
+	HeaderSurrogateKey    = "Surrogate-Key"
+	HeaderUpgrade         = "Upgrade"
+	HeaderVary            = "Vary"
+	HeaderXAccelBuffering = "X-Accel-Buffering"
 )
 
 var DataContentTypes = []string{
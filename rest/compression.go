@@ -0,0 +1,196 @@
+package rest
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/tliron/go-ard"
+	"github.com/tliron/prudence/platform"
+)
+
+// Already-compressed formats. Used if "excludeContentTypes" is not set.
+var DefaultExcludeContentTypes = []string{
+	"image/avif",
+	"image/gif",
+	"image/heic",
+	"image/jpeg",
+	"image/jxl",
+	"image/png",
+	"image/webp",
+	"audio/*",
+	"video/*",
+	"font/woff",
+	"font/woff2",
+	"application/gzip",
+	"application/zip",
+	"application/zstd",
+	"application/x-7z-compressed",
+	"application/x-bzip2",
+	"application/x-rar-compressed",
+	"application/x-xz",
+	"application/pdf",
+	"application/octet-stream",
+}
+
+//
+// Compression
+//
+// Controls how responses are encoded. A nil *Compression means that all
+// responses are encoded with the client's preferred encoding at the default
+// level.
+//
+
+type Compression struct {
+	Encodings           []platform.EncodingType // in order of server preference; empty for all supported
+	Levels              platform.EncodingLevels
+	MinSize             int      // bodies smaller than this will not be encoded
+	ContentTypes        []string // if not empty only these will be encoded; supports "type/*"
+	ExcludeContentTypes []string // supports "type/*"
+	Streaming           bool     // encode while writing instead of after presenting
+}
+
+func NewCompression() *Compression {
+	return &Compression{
+		Levels:              make(platform.EncodingLevels),
+		ExcludeContentTypes: DefaultExcludeContentTypes,
+	}
+}
+
+func CreateCompression(config *ard.Node) (*Compression, error) {
+	self := NewCompression()
+
+	for _, name := range platform.AsStringList(config.Get("encodings")) {
+		if encoding, err := getCompressionEncoding(name); err == nil {
+			self.Encodings = append(self.Encodings, encoding)
+		} else {
+			return nil, err
+		}
+	}
+
+	if levels, ok := config.Get("levels").StringMap(); ok {
+		for name, level := range levels {
+			encoding, err := getCompressionEncoding(name)
+			if err != nil {
+				return nil, err
+			}
+
+			if level_, ok := ard.With(level).ConvertSimilar().Integer(); ok {
+				self.Levels[encoding] = int(level_)
+			} else {
+				return nil, fmt.Errorf("\"compression.levels\" value is not an integer: %s", name)
+			}
+		}
+	}
+
+	if minSize, ok := config.Get("minSize").UnsignedInteger(); ok {
+		self.MinSize = int(minSize)
+	}
+
+	self.ContentTypes = platform.AsStringList(config.Get("contentTypes"))
+
+	if excludeContentTypes := config.Get("excludeContentTypes"); excludeContentTypes.Value != nil {
+		self.ExcludeContentTypes = platform.AsStringList(excludeContentTypes)
+	}
+
+	self.Streaming, _ = config.Get("streaming").Boolean()
+
+	return self, nil
+}
+
+// Returns nil if the config is not set.
+func GetCompression(config *ard.Node) (*Compression, error) {
+	if config.Value != nil {
+		return CreateCompression(config)
+	} else {
+		return nil, nil
+	}
+}
+
+// Whether the server is willing to use the encoding at all.
+func (self *Compression) Supports(encoding platform.EncodingType) bool {
+	if (self == nil) || (len(self.Encodings) == 0) || (encoding == platform.EncodingTypeIdentity) {
+		return true
+	}
+
+	for _, encoding_ := range self.Encodings {
+		if encoding_ == encoding {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Lower is more preferred. Encodings not in the list are least preferred.
+func (self *Compression) Rank(encoding platform.EncodingType) int {
+	if self != nil {
+		for index, encoding_ := range self.Encodings {
+			if encoding_ == encoding {
+				return index
+			}
+		}
+		return len(self.Encodings)
+	}
+
+	return 0
+}
+
+func (self *Compression) Level(encoding platform.EncodingType) int {
+	if self != nil {
+		return self.Levels.Get(encoding)
+	} else {
+		return platform.DefaultEncodingLevel
+	}
+}
+
+// Whether a body of this content type and size should be encoded.
+func (self *Compression) ShouldEncode(contentType string, size int) bool {
+	if self == nil {
+		return true
+	}
+
+	if size < self.MinSize {
+		return false
+	}
+
+	if contentType == "" {
+		return true
+	}
+
+	if len(self.ContentTypes) > 0 {
+		return matchContentTypes(contentType, self.ContentTypes)
+	}
+
+	return !matchContentTypes(contentType, self.ExcludeContentTypes)
+}
+
+func getCompressionEncoding(name string) (platform.EncodingType, error) {
+	switch encoding := platform.GetEncodingFromHeader(name); encoding {
+	case platform.EncodingTypeBrotli, platform.EncodingTypeDeflate, platform.EncodingTypeGZip, platform.EncodingTypeZstandard:
+		return encoding, nil
+
+	default:
+		return platform.EncodingTypeUnsupported, fmt.Errorf("unsupported compression encoding: %s", name)
+	}
+}
+
+func matchContentTypes(contentType string, patterns []string) bool {
+	// Ignore parameters, e.g. "; charset=utf-8"
+	if index := strings.IndexByte(contentType, ';'); index != -1 {
+		contentType = contentType[:index]
+	}
+	contentType = strings.ToLower(strings.TrimSpace(contentType))
+
+	for _, pattern := range patterns {
+		pattern = strings.ToLower(pattern)
+		if strings.HasSuffix(pattern, "/*") {
+			if strings.HasPrefix(contentType, pattern[:len(pattern)-1]) {
+				return true
+			}
+		} else if contentType == pattern {
+			return true
+		}
+	}
+
+	return false
+}
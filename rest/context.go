@@ -5,7 +5,6 @@ import (
 	"fmt"
 	"net/http"
 	urlpkg "net/url"
-	"strconv"
 	"strings"
 	"sync/atomic"
 	"time"
@@ -13,6 +12,7 @@ import (
 	"github.com/tliron/commonjs-goja/api"
 	"github.com/tliron/commonlog"
 	"github.com/tliron/go-scriptlet/jst"
+	"github.com/tliron/prudence/platform"
 )
 
 //
@@ -30,6 +30,13 @@ type Context struct {
 	Log   commonlog.Logger
 	Debug bool
 
+	// Response headers in which to emit CacheGroups for downstream caches
+	SurrogateKeyHeaders []string
+
+	Compression *Compression // nil to encode everything
+
+	Timeout time.Duration // for handling the request, also used for background revalidation
+
 	Done    bool
 	Created bool
 	Async   bool
@@ -37,6 +44,15 @@ type Context struct {
 	CacheDuration float64 // seconds
 	CacheKey      string
 	CacheGroups   []string
+	CacheVary     []string // names of request headers
+
+	// Extra time (in seconds) after CacheDuration during which a stale cached
+	// representation may be used. See RFC 5861.
+	StaleWhileRevalidate float64 // while regenerating it in the background
+	StaleIfError         float64 // if regenerating it fails
+
+	revalidating bool
+	stored       *platform.CachedRepresentation // by the last call to StoreCachedRepresentation
 }
 
 var requestId atomic.Uint64
@@ -69,6 +85,10 @@ func (self *Context) Clone() *Context {
 		Name:     self.Name,
 		Log:      self.Log,
 		Debug:    self.Debug,
+
+		SurrogateKeyHeaders: self.SurrogateKeyHeaders,
+		Compression:         self.Compression,
+		Timeout:             self.Timeout,
 	}
 }
 
@@ -203,6 +223,18 @@ func (self *Context) EndSignature() error {
 
 // Utils
 
+// Replaces "{name}" with the value of the variable.
+func (self *Context) expandVariables(template string) string {
+	if !strings.Contains(template, "{") {
+		return template
+	}
+
+	for name, value := range self.Variables {
+		template = strings.ReplaceAll(template, "{"+name+"}", fmt.Sprintf("%v", value))
+	}
+	return template
+}
+
 func (self *Context) caching() bool {
 	return (self.CacheDuration > 0.0) && (self.CacheKey != "")
 }
@@ -246,7 +278,45 @@ func (self *Context) setCacheControl() {
 		self.Response.Header.Set(HeaderCacheControl, "no-store,max-age=0")
 	} else if self.CacheDuration > 0.0 {
 		// Match client-side caching with server-side caching
-		maxAge := int64(self.CacheDuration)
-		self.Response.Header.Set(HeaderCacheControl, "max-age="+strconv.FormatInt(maxAge, 10))
+		self.Response.Header.Set(HeaderCacheControl, cacheControl(self.CacheDuration, self.StaleWhileRevalidate, self.StaleIfError))
+	}
+}
+
+func (self *Context) setVary() {
+	// Vary
+	// https://developer.mozilla.org/en-US/docs/Web/HTTP/Headers/Vary
+	if len(self.CacheVary) == 0 {
+		return
+	}
+
+	names := make(map[string]struct{})
+	for _, value := range self.Response.Header.Values(HeaderVary) {
+		for _, name := range strings.Split(value, ",") {
+			names[http.CanonicalHeaderKey(strings.TrimSpace(name))] = struct{}{}
+		}
+	}
+
+	for _, name := range self.CacheVary {
+		name = http.CanonicalHeaderKey(name)
+		if _, ok := names[name]; !ok {
+			self.Response.Header.Add(HeaderVary, name)
+			names[name] = struct{}{}
+		}
+	}
+}
+
+func (self *Context) setSurrogateKeys() {
+	// Surrogate-Key (Fastly, Varnish xkey), Cache-Tag (Cloudflare, Akamai)
+	// https://developer.fastly.com/reference/http/http-headers/Surrogate-Key/
+	if (len(self.SurrogateKeyHeaders) == 0) || (len(self.CacheGroups) == 0) {
+		return
+	}
+
+	for _, name := range self.SurrogateKeyHeaders {
+		if http.CanonicalHeaderKey(name) == HeaderCacheTag {
+			self.Response.Header.Set(name, strings.Join(self.CacheGroups, ","))
+		} else {
+			self.Response.Header.Set(name, strings.Join(self.CacheGroups, " "))
+		}
 	}
 }
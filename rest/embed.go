@@ -8,26 +8,77 @@ import (
 )
 
 func (self *Context) Embed(present any, jsContext *commonjs.Context) error {
-	if self.CacheKey != "" {
+	var err error
+	if present, jsContext, err = commonjs.Unbind(present, jsContext); err != nil {
+		return err
+	}
+
+	var stale *platform.CachedRepresentation
+	if (self.CacheKey != "") && !self.revalidating {
 		if key, cached, ok := self.LoadCachedRepresentation(); ok {
 			if len(cached.Body) == 0 {
 				self.Log.Debugf("embed: ignoring cache with no body: %s", self.Request.Path)
-			} else if changed, err := self.WriteCachedRepresentation(cached); err == nil {
-				if changed {
-					self.UpdateCachedRepresentation(key, cached)
+			} else if !cached.Expired() || cached.CanRevalidate() {
+				if cached.Expired() {
+					self.revalidateEmbed(key, present, jsContext)
 				}
-				return nil
-			} else {
-				return err
+				if changed, err := self.WriteCachedRepresentation(cached); err == nil {
+					if changed {
+						self.UpdateCachedRepresentation(key, cached)
+					}
+					return nil
+				} else {
+					return err
+				}
+			} else if cached.CanServeOnError() {
+				stale = cached
 			}
 		}
 	}
 
-	var err error
-	if present, jsContext, err = commonjs.Unbind(present, jsContext); err != nil {
-		return err
+	render := func() error {
+		return self.embed(present, jsContext)
+	}
+
+	if self.CacheKey != "" {
+		var cached *platform.CachedRepresentation
+		if cached, err = self.Coalesce(true, render); (err == nil) && (cached != nil) {
+			_, err = self.WriteCachedRepresentation(cached)
+		}
+	} else {
+		err = render()
+	}
+
+	if (err != nil) && (stale != nil) {
+		self.Log.Warningf("embed: using stale cached representation because of error: %s", err.Error())
+		_, err = self.WriteCachedRepresentation(stale)
 	}
 
+	return err
+}
+
+// Unlike representations, embedded representations do not have a "prepare"
+// hook that sets up caching, so we copy the caching settings.
+func (self *Context) revalidateEmbed(key platform.CacheKey, present any, jsContext *commonjs.Context) {
+	cacheDuration := self.CacheDuration
+	cacheKey := self.CacheKey
+	cacheGroups := append([]string(nil), self.CacheGroups...)
+	cacheVary := append([]string(nil), self.CacheVary...)
+	staleWhileRevalidate := self.StaleWhileRevalidate
+	staleIfError := self.StaleIfError
+
+	self.revalidate(key, func(restContext *Context) error {
+		restContext.CacheDuration = cacheDuration
+		restContext.CacheKey = cacheKey
+		restContext.CacheGroups = cacheGroups
+		restContext.CacheVary = cacheVary
+		restContext.StaleWhileRevalidate = staleWhileRevalidate
+		restContext.StaleIfError = staleIfError
+		return restContext.embed(present, jsContext)
+	})
+}
+
+func (self *Context) embed(present any, jsContext *commonjs.Context) error {
 	if self.caching() {
 		buffer := bytes.NewBuffer(nil)
 		writer := self.Writer
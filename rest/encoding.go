@@ -1,6 +1,8 @@
 package rest
 
 import (
+	"math"
+	"mime"
 	"net/http"
 	"sort"
 	"strings"
@@ -24,7 +26,45 @@ func SetBestEncodeWriter(restContext *Context) bool {
 		return false
 	}
 
-	restContext.Writer = encoding.NewWriter(restContext.Writer)
+	compression := restContext.Compression
+	if compression == nil {
+		restContext.Writer = encoding.NewWriter(restContext.Writer)
+		return true
+	}
+
+	shouldEncode := func(body []byte) bool {
+		size := len(body)
+		if restContext.Response.streaming {
+			// We don't know the final size
+			size = math.MaxInt
+		}
+		contentType := restContext.Response.ContentType
+		if contentType == "" {
+			// Might have been set directly, e.g. by a proxy
+			contentType, _, _ = mime.ParseMediaType(restContext.Response.Header.Get(HeaderContentType))
+		}
+		if compression.ShouldEncode(contentType, size) {
+			return true
+		}
+		restContext.Response.Header.Del(HeaderContentEncoding)
+		return false
+	}
+
+	if compression.Streaming {
+		// We decide once we have MinSize bytes
+		writer := encoding.NewStreamWriter(restContext.Writer)
+		writer.Level = compression.Level(encoding)
+		writer.Threshold = compression.MinSize
+		writer.ShouldEncode = shouldEncode
+		restContext.Writer = writer
+	} else {
+		// We decide after presenting, when we know the final content type and size
+		writer := encoding.NewWriter(restContext.Writer)
+		writer.Level = compression.Level(encoding)
+		writer.ShouldEncode = shouldEncode
+		restContext.Writer = writer
+	}
+
 	return true
 }
 
@@ -88,18 +128,43 @@ func (self EncodingPreferences) ForbidIdentity() bool {
 	return false
 }
 
+// Among the client's most preferred encodings we choose the one the server
+// prefers (see [Compression.Encodings]).
 func (self EncodingPreferences) NegotiateBest(restContext *Context) platform.EncodingType {
+	compression := restContext.Compression
+	best := platform.EncodingTypeUnsupported
+	var bestWeight float64
+	var bestRank int
+
 	for _, encodingPreference := range self {
 		if encodingPreference.Weight != 0.0 {
 			switch encodingPreference.Type {
 			// Note: "compress" has been deprecated
 			case platform.EncodingTypeUnsupported, platform.EncodingTypeCompress:
 			default:
-				return encodingPreference.Type
+				if !compression.Supports(encodingPreference.Type) {
+					continue
+				}
+
+				if best == platform.EncodingTypeUnsupported {
+					best = encodingPreference.Type
+					bestWeight = encodingPreference.Weight
+					bestRank = compression.Rank(best)
+				} else if encodingPreference.Weight < bestWeight {
+					// Sorted by weight
+					return best
+				} else if rank := compression.Rank(encodingPreference.Type); rank < bestRank {
+					best = encodingPreference.Type
+					bestRank = rank
+				}
 			}
 		}
 	}
 
+	if best != platform.EncodingTypeUnsupported {
+		return best
+	}
+
 	if !self.ForbidIdentity() {
 		return platform.EncodingTypeIdentity
 	} else {
@@ -0,0 +1,179 @@
+package rest
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/tliron/commonjs-goja"
+	"github.com/tliron/go-ard"
+	"github.com/tliron/prudence/platform"
+)
+
+const (
+	DEFAULT_EVENT_STREAM_KEEP_ALIVE = 15 * time.Second
+	DEFAULT_EVENT_STREAM_BUFFER     = 64
+)
+
+//
+// EventStream
+//
+
+// Server-Sent Events.
+//
+// See: https://html.spec.whatwg.org/multipage/server-sent-events.html
+type EventStream struct {
+	Channel   string        // can contain "{variable}"
+	KeepAlive time.Duration // 0 to disable
+	Retry     time.Duration // 0 to use the client default
+	Buffer    int           // events waiting for a slow client
+}
+
+func NewEventStream(channel string) *EventStream {
+	return &EventStream{
+		Channel:   channel,
+		KeepAlive: DEFAULT_EVENT_STREAM_KEEP_ALIVE,
+		Buffer:    DEFAULT_EVENT_STREAM_BUFFER,
+	}
+}
+
+// ([platform.CreateFunc] signature)
+func CreateEventStream(jsContext *commonjs.Context, config ard.StringMap) (any, error) {
+	config_ := ard.With(config).ConvertSimilar().NilMeansZero()
+
+	self := NewEventStream("")
+
+	self.Channel, _ = config_.Get("channel").String()
+	if self.Channel == "" {
+		return nil, fmt.Errorf("EventStream \"channel\" must be set")
+	}
+
+	if keepAlive, ok := config_.Get("keepAlive").Float(); ok {
+		self.KeepAlive = time.Duration(keepAlive * float64(time.Second))
+	}
+
+	if retry, ok := config_.Get("retry").Float(); ok {
+		self.Retry = time.Duration(retry * float64(time.Second))
+	}
+
+	if buffer, ok := config_.Get("buffer").Integer(); ok {
+		self.Buffer = int(buffer)
+	}
+
+	return self, nil
+}
+
+// ([Handler] interface, [HandleFunc] signature)
+func (self *EventStream) Handle(restContext *Context) (bool, error) {
+	if restContext.Request.Method != http.MethodGet {
+		restContext.Response.Status = http.StatusMethodNotAllowed
+		return true, nil
+	}
+
+	channel := restContext.expandVariables(self.Channel)
+
+	restContext.CacheDuration = 0.0
+	restContext.Response.Status = http.StatusOK
+	restContext.Response.ContentType = "text/event-stream"
+	restContext.Response.Header.Set(HeaderCacheControl, "no-cache")
+	restContext.Response.Header.Set(HeaderXAccelBuffering, "no") // for nginx
+
+	// The connection stays open for as long as the client wants
+	if err := http.NewResponseController(restContext.Response.Direct).SetWriteDeadline(time.Time{}); err != nil {
+		restContext.Log.Debugf("cannot clear write deadline: %s", err.Error())
+	}
+
+	subscription, missed := platform.SubscribeEvents(channel, restContext.Request.Header.Get(HeaderLastEventID), self.Buffer)
+	defer subscription.Unsubscribe()
+
+	if self.Retry > 0 {
+		if _, err := fmt.Fprintf(restContext.Writer, "retry: %d\n\n", self.Retry.Milliseconds()); err != nil {
+			return true, err
+		}
+	}
+
+	for _, event := range missed {
+		if err := writeEvent(restContext.Writer, event); err != nil {
+			return true, err
+		}
+	}
+
+	if err := restContext.StartStreaming(); err != nil {
+		return true, err
+	}
+
+	restContext.Log.Debugf("event stream started: %s", channel)
+
+	var keepAlive <-chan time.Time
+	if self.KeepAlive > 0 {
+		ticker := time.NewTicker(self.KeepAlive)
+		defer ticker.Stop()
+		keepAlive = ticker.C
+	}
+
+	done := restContext.Request.Direct.Context().Done()
+
+	for {
+		select {
+		case event, ok := <-subscription.Events:
+			if !ok {
+				// Unsubscribed (the client is too slow); it will reconnect
+				return true, nil
+			}
+			if err := writeEvent(restContext.Writer, event); err != nil {
+				return true, err
+			}
+
+		case <-keepAlive:
+			if _, err := io.WriteString(restContext.Writer, ":\n\n"); err != nil {
+				return true, err
+			}
+
+		case <-done:
+			restContext.Log.Debugf("event stream ended: %s", channel)
+			return true, nil
+		}
+
+		if err := restContext.FlushStream(); err != nil {
+			// Most likely the client disconnected
+			restContext.Log.Debugf("event stream ended: %s", err.Error())
+			return true, nil
+		}
+	}
+}
+
+// Line breaks would break the framing of single-line fields.
+var eventFieldEscaper = strings.NewReplacer("\r", "", "\n", "")
+
+// In SSE "\r\n", "\r", and "\n" all end a line.
+var eventDataLineBreaks = strings.NewReplacer("\r\n", "\n", "\r", "\n")
+
+func writeEvent(writer io.Writer, event *platform.Event) error {
+	var builder strings.Builder
+
+	if event.ID != "" {
+		builder.WriteString("id: ")
+		builder.WriteString(eventFieldEscaper.Replace(event.ID))
+		builder.WriteRune('\n')
+	}
+
+	if event.Type != "" {
+		builder.WriteString("event: ")
+		builder.WriteString(eventFieldEscaper.Replace(event.Type))
+		builder.WriteRune('\n')
+	}
+
+	data := eventDataLineBreaks.Replace(event.Data)
+	for _, line := range strings.Split(data, "\n") {
+		builder.WriteString("data: ")
+		builder.WriteString(line)
+		builder.WriteRune('\n')
+	}
+
+	builder.WriteRune('\n')
+
+	_, err := io.WriteString(writer, builder.String())
+	return err
+}
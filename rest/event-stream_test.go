@@ -0,0 +1,34 @@
+package rest
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/tliron/prudence/platform"
+)
+
+func TestWriteEvent(t *testing.T) {
+	tests := []struct {
+		event    platform.Event
+		expected string
+	}{
+		{platform.Event{Data: "hello"}, "data: hello\n\n"},
+		{platform.Event{ID: "1", Type: "greeting", Data: "hello"}, "id: 1\nevent: greeting\ndata: hello\n\n"},
+		{platform.Event{Data: "a\nb\r\nc\rd"}, "data: a\ndata: b\ndata: c\ndata: d\n\n"},
+
+		// Line breaks must not inject fields
+		{platform.Event{ID: "1\nevent: evil", Data: "x"}, "id: 1event: evil\ndata: x\n\n"},
+		{platform.Event{Type: "a\r\ndata: evil", Data: "x"}, "event: adata: evil\ndata: x\n\n"},
+		{platform.Event{Data: "x\revent: evil\rdata: y"}, "data: x\ndata: event: evil\ndata: data: y\n\n"},
+	}
+
+	for _, test := range tests {
+		var builder strings.Builder
+		if err := writeEvent(&builder, &test.event); err != nil {
+			t.Fatal(err)
+		}
+		if builder.String() != test.expected {
+			t.Errorf("%#v: expected %q, got %q", test.event, test.expected, builder.String())
+		}
+	}
+}
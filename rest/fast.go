@@ -0,0 +1,220 @@
+package rest
+
+import (
+	"bytes"
+	"crypto/tls"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/tliron/commonlog"
+	"github.com/valyala/fasthttp"
+	"gocloud.dev/server/requestlog"
+)
+
+const (
+	EngineNetHTTP  = "nethttp"
+	EngineFastHTTP = "fasthttp"
+)
+
+// Note that fasthttp does not support HTTP/2 and has no equivalent to
+// ReadHeaderTimeout (it is covered by ReadTimeout).
+func (self *Server) newFastServer(tlsConfig *tls.Config) *fasthttp.Server {
+	if tlsConfig != nil {
+		// Remove "h2" but keep other protocols (e.g. ACME's)
+		var nextProtos []string
+		for _, nextProto := range tlsConfig.NextProtos {
+			if nextProto != "h2" {
+				nextProtos = append(nextProtos, nextProto)
+			}
+		}
+		tlsConfig.NextProtos = nextProtos
+	}
+
+	var handler fasthttp.RequestHandler = self.HandleFastHTTP
+
+	if logger := self.newNcsaLogger(); logger != nil {
+		handler = newFastNcsaHandler(logger, handler)
+	}
+
+	if self.HandlerTimeout > 0 {
+		// Same status as net/http's TimeoutHandler
+		handler = fasthttp.TimeoutWithCodeHandler(handler, self.HandlerTimeout, "", http.StatusServiceUnavailable)
+	}
+
+	server := &fasthttp.Server{
+		Handler:               handler,
+		ReadTimeout:           self.ReadTimeout,
+		WriteTimeout:          self.WriteTimeout,
+		IdleTimeout:           self.IdleTimeout,
+		NoDefaultServerHeader: true, // we set it ourselves
+		NoDefaultContentType:  true,
+		Logger:                fastLogger{self.log},
+	}
+
+	if self.log.AllowLevel(commonlog.Debug) {
+		server.ConnState = func(conn net.Conn, state fasthttp.ConnState) {
+			self.log.Debug(state.String(), "_scope", "connection")
+		}
+	}
+
+	return server
+}
+
+// ([fasthttp.RequestHandler] signature)
+func (self *Server) HandleFastHTTP(ctx *fasthttp.RequestCtx) {
+	if request, err := NewFastRequest(ctx); err == nil {
+		responseWriter := NewFastResponseWriter(ctx)
+		self.ServeHTTP(responseWriter, request)
+		responseWriter.flush()
+	} else {
+		self.log.Errorf("malformed request: %s", err.Error())
+		ctx.Error(http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+	}
+}
+
+// Converts to a [http.Request] so that the rest of the Prudence API works the
+// same with both engines.
+//
+// Note that we copy all strings, because fasthttp reuses its buffers after the
+// handler returns, while we might still be using the strings (e.g. in cache keys).
+func NewFastRequest(ctx *fasthttp.RequestCtx) (*http.Request, error) {
+	requestUri := string(ctx.RequestURI())
+
+	url_, err := url.ParseRequestURI(requestUri)
+	if err != nil {
+		return nil, err
+	}
+
+	body := bytes.Clone(ctx.PostBody())
+
+	request := http.Request{
+		Method:        string(ctx.Method()),
+		URL:           url_,
+		Proto:         string(ctx.Request.Header.Protocol()),
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        make(http.Header),
+		Body:          io.NopCloser(bytes.NewReader(body)),
+		ContentLength: int64(len(body)),
+		Host:          string(ctx.Host()),
+		RemoteAddr:    ctx.RemoteAddr().String(),
+		RequestURI:    requestUri,
+		TLS:           ctx.TLSConnectionState(),
+	}
+
+	ctx.Request.Header.VisitAll(func(name []byte, value []byte) {
+		name_ := string(name)
+		if name_ == "Transfer-Encoding" {
+			request.TransferEncoding = append(request.TransferEncoding, string(value))
+		} else {
+			request.Header.Add(name_, string(value))
+		}
+	})
+
+	return request.WithContext(ctx), nil
+}
+
+//
+// FastResponseWriter
+//
+
+type FastResponseWriter struct {
+	ctx         *fasthttp.RequestCtx
+	header      http.Header
+	wroteHeader bool
+}
+
+func NewFastResponseWriter(ctx *fasthttp.RequestCtx) *FastResponseWriter {
+	return &FastResponseWriter{
+		ctx:    ctx,
+		header: make(http.Header),
+	}
+}
+
+// ([http.ResponseWriter] interface)
+func (self *FastResponseWriter) Header() http.Header {
+	return self.header
+}
+
+// ([http.ResponseWriter] interface)
+func (self *FastResponseWriter) WriteHeader(status int) {
+	if self.wroteHeader {
+		return
+	}
+	self.wroteHeader = true
+
+	self.ctx.SetStatusCode(status)
+
+	header := &self.ctx.Response.Header
+	for name, values := range self.header {
+		switch name {
+		case HeaderContentType:
+			if len(values) > 0 {
+				header.SetContentType(values[0])
+			}
+
+		default:
+			for _, value := range values {
+				header.Add(name, value)
+			}
+		}
+	}
+}
+
+// ([http.ResponseWriter] interface, [io.Writer] interface)
+func (self *FastResponseWriter) Write(p []byte) (int, error) {
+	if !self.wroteHeader {
+		self.WriteHeader(http.StatusOK)
+	}
+	return self.ctx.Write(p)
+}
+
+// fasthttp always buffers the whole response, so it cannot stream. We
+// report this to [http.ResponseController] instead of silently ignoring the
+// flush.
+func (self *FastResponseWriter) FlushError() error {
+	return http.ErrNotSupported
+}
+
+func (self *FastResponseWriter) flush() {
+	if !self.wroteHeader {
+		self.WriteHeader(http.StatusOK)
+	}
+}
+
+//
+// fastNcsaHandler
+//
+
+func newFastNcsaHandler(logger *requestlog.NCSALogger, handler fasthttp.RequestHandler) fasthttp.RequestHandler {
+	return func(ctx *fasthttp.RequestCtx) {
+		handler(ctx)
+
+		// The logger only needs the request line and headers
+		if request, err := NewFastRequest(ctx); err == nil {
+			entry := newNcsaEntry(request, ctx.Time())
+			entry.RequestBodySize = int64(len(ctx.PostBody()))
+			entry.Status = ctx.Response.StatusCode()
+			entry.ResponseBodySize = int64(len(ctx.Response.Body()))
+			entry.Latency = time.Since(ctx.Time())
+			logger.Log(entry)
+		}
+	}
+}
+
+//
+// fastLogger
+//
+
+type fastLogger struct {
+	log commonlog.Logger
+}
+
+// ([fasthttp.Logger] interface)
+func (self fastLogger) Printf(format string, args ...any) {
+	self.log.Debugf(strings.TrimSuffix(format, "\n"), args...)
+}
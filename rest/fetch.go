@@ -0,0 +1,30 @@
+package rest
+
+import (
+	"errors"
+
+	"github.com/tliron/go-ard"
+)
+
+// Set by the client package (which depends on this package) to its default
+// client's fetch.
+var FetchFunc func(url string, options ard.StringMap) (any, error)
+
+// Like "prudence.fetch" but the "context" option defaults to this context, so
+// that the fetch is canceled with the request we are handling and uses its
+// deadline.
+func (self *Context) Fetch(url string, options ard.StringMap) (any, error) {
+	if FetchFunc == nil {
+		return nil, errors.New("fetch is not available")
+	}
+
+	options_ := make(ard.StringMap, len(options)+1)
+	for name, value := range options {
+		options_[name] = value
+	}
+	if _, ok := options_["context"]; !ok {
+		options_["context"] = self
+	}
+
+	return FetchFunc(url, options_)
+}
@@ -0,0 +1,235 @@
+package rest
+
+import (
+	"bufio"
+	"bytes"
+	contextpkg "context"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+)
+
+//
+// timeoutHandler
+//
+// Like [http.TimeoutHandler], buffers the response and sends a 503 status if
+// the handler does not finish in time. However, once the handler flushes (i.e.
+// starts streaming) or hijacks the connection (e.g. for WebSockets) we send
+// what we have, stop buffering, and the timeout no longer applies.
+//
+
+type timeoutHandler struct {
+	handler http.Handler
+	timeout time.Duration
+}
+
+func newTimeoutHandler(handler http.Handler, timeout time.Duration) *timeoutHandler {
+	return &timeoutHandler{
+		handler: handler,
+		timeout: timeout,
+	}
+}
+
+// ([http.Handler] interface)
+func (self *timeoutHandler) ServeHTTP(responseWriter http.ResponseWriter, request *http.Request) {
+	context, cancel := contextpkg.WithCancel(request.Context())
+	defer cancel()
+	request = request.WithContext(context)
+
+	writer := newTimeoutWriter(responseWriter)
+	done := make(chan struct{})
+	panics := make(chan any, 1)
+
+	go func() {
+		defer func() {
+			if r := recover(); r != nil {
+				panics <- r
+			}
+		}()
+
+		self.handler.ServeHTTP(writer, request)
+		close(done)
+	}()
+
+	timer := time.NewTimer(self.timeout)
+	defer timer.Stop()
+
+	select {
+	case r := <-panics:
+		panic(r)
+
+	case <-done:
+		writer.finish()
+
+	case <-timer.C:
+		if writer.expire() {
+			cancel()
+		} else {
+			// The handler is streaming, so we must wait for it
+			select {
+			case r := <-panics:
+				panic(r)
+
+			case <-done:
+			}
+		}
+	}
+}
+
+//
+// timeoutWriter
+//
+
+type timeoutWriter struct {
+	writer   http.ResponseWriter
+	header   http.Header
+	buffer   bytes.Buffer
+	status   int
+	detached bool
+	expired  bool
+	lock     sync.Mutex
+}
+
+func newTimeoutWriter(writer http.ResponseWriter) *timeoutWriter {
+	return &timeoutWriter{
+		writer: writer,
+		header: make(http.Header),
+	}
+}
+
+// ([http.ResponseWriter] interface)
+func (self *timeoutWriter) Header() http.Header {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+
+	if self.detached {
+		return self.writer.Header()
+	}
+	return self.header
+}
+
+// ([http.ResponseWriter] interface)
+func (self *timeoutWriter) WriteHeader(statusCode int) {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+
+	if self.expired {
+		return
+	}
+
+	if self.detached {
+		self.writer.WriteHeader(statusCode)
+	} else if self.status == 0 {
+		self.status = statusCode
+	}
+}
+
+// ([http.ResponseWriter] interface, [io.Writer] interface)
+func (self *timeoutWriter) Write(bytes []byte) (int, error) {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+
+	if self.expired {
+		return 0, http.ErrHandlerTimeout
+	}
+
+	if self.detached {
+		return self.writer.Write(bytes)
+	}
+
+	if self.status == 0 {
+		self.status = http.StatusOK
+	}
+	return self.buffer.Write(bytes)
+}
+
+// (used by [http.ResponseController])
+func (self *timeoutWriter) FlushError() error {
+	self.lock.Lock()
+	if self.expired {
+		self.lock.Unlock()
+		return http.ErrHandlerTimeout
+	}
+	err := self.detach()
+	self.lock.Unlock()
+
+	if err != nil {
+		return err
+	}
+
+	return http.NewResponseController(self.writer).Flush()
+}
+
+// ([http.Flusher] interface)
+func (self *timeoutWriter) Flush() {
+	self.FlushError()
+}
+
+// ([http.Hijacker] interface)
+func (self *timeoutWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+
+	if self.expired {
+		return nil, nil, http.ErrHandlerTimeout
+	}
+
+	self.detached = true
+	return http.NewResponseController(self.writer).Hijack()
+}
+
+// (used by [http.ResponseController], e.g. for setting deadlines)
+func (self *timeoutWriter) Unwrap() http.ResponseWriter {
+	return self.writer
+}
+
+// Call when locked.
+func (self *timeoutWriter) detach() error {
+	if self.detached {
+		return nil
+	}
+
+	self.detached = true
+	self.copyHeader()
+	if self.status != 0 {
+		self.writer.WriteHeader(self.status)
+	}
+	if self.buffer.Len() > 0 {
+		if _, err := self.writer.Write(self.buffer.Bytes()); err != nil {
+			return err
+		}
+		self.buffer.Reset()
+	}
+
+	return nil
+}
+
+func (self *timeoutWriter) finish() {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+
+	self.detach()
+}
+
+// Returns false if detached, in which case the timeout does not apply.
+func (self *timeoutWriter) expire() bool {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+
+	if self.detached {
+		return false
+	}
+
+	self.expired = true
+	http.Error(self.writer, http.StatusText(http.StatusServiceUnavailable), http.StatusServiceUnavailable)
+	return true
+}
+
+// Call when locked.
+func (self *timeoutWriter) copyHeader() {
+	header := self.writer.Header()
+	for name, values := range self.header {
+		header[name] = values
+	}
+}
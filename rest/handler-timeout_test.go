@@ -0,0 +1,67 @@
+package rest
+
+import (
+	"bufio"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestTimeoutHandlerUpgradeHeader(t *testing.T) {
+	handler := newTimeoutHandler(http.HandlerFunc(func(responseWriter http.ResponseWriter, request *http.Request) {
+		// Wait until canceled
+		<-request.Context().Done()
+	}), 50*time.Millisecond)
+
+	// Claiming to upgrade must not exempt a request from the timeout
+	request := httptest.NewRequest(http.MethodGet, "/", nil)
+	request.Header.Set(HeaderUpgrade, "x")
+	recorder := httptest.NewRecorder()
+
+	done := make(chan struct{})
+	go func() {
+		handler.ServeHTTP(recorder, request)
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("handler did not time out")
+	}
+
+	if recorder.Code != http.StatusServiceUnavailable {
+		t.Errorf("expected status %d, got %d", http.StatusServiceUnavailable, recorder.Code)
+	}
+}
+
+func TestTimeoutHandlerHijack(t *testing.T) {
+	server := httptest.NewServer(newTimeoutHandler(http.HandlerFunc(func(responseWriter http.ResponseWriter, request *http.Request) {
+		conn, buffer, err := http.NewResponseController(responseWriter).Hijack()
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		defer conn.Close()
+
+		// Hijacked connections are no longer subject to the timeout
+		time.Sleep(200 * time.Millisecond)
+		buffer.WriteString("HTTP/1.1 200 OK\r\nContent-Length: 2\r\nConnection: close\r\n\r\nok")
+		buffer.Flush()
+	}), 50*time.Millisecond))
+	defer server.Close()
+
+	response, err := http.Get(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusOK {
+		t.Errorf("expected status %d, got %d", http.StatusOK, response.StatusCode)
+	}
+	if line, _ := bufio.NewReader(response.Body).ReadString('\n'); line != "ok" {
+		t.Errorf("wrong body: %q", line)
+	}
+}
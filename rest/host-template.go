@@ -0,0 +1,172 @@
+package rest
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+//
+// HostTemplate
+//
+// Matches hosts (case-insensitively) and extracts variables.
+//
+// Variables are wrapped in "{" and "}" and do not extend beyond a dot, unless "*"
+// appears before the "}".
+//
+// The "*" wildcard matches one or more characters, including dots. Thus "*.example.com"
+// matches any subdomain of "example.com", but not "example.com" itself.
+//
+
+type HostTemplate struct {
+	Template          string
+	RegularExpression *regexp.Regexp
+}
+
+var HostTemplateAll = &HostTemplate{"", nil}
+
+func NewHostTemplate(host string) (*HostTemplate, error) {
+	if (host == "") || (host == "*") {
+		// Empty template always matches
+		return HostTemplateAll, nil
+	}
+
+	var builder strings.Builder
+	var inVariable bool
+	var variableContainsWildcard bool
+
+	builder.WriteRune('^')
+
+	for _, rune_ := range strings.ToLower(host) {
+		if inVariable {
+			switch rune_ {
+			case '}':
+				if variableContainsWildcard {
+					builder.WriteString(`>.+)`)
+					variableContainsWildcard = false
+				} else {
+					builder.WriteString(`>[^.]+)`)
+				}
+				inVariable = false
+
+			case '*':
+				variableContainsWildcard = true
+
+			default:
+				if variableContainsWildcard {
+					return nil, fmt.Errorf("variable name in host template has \"*\" but not as last character: %s", host)
+				}
+
+				// Group name
+				builder.WriteRune(rune_)
+			}
+		} else {
+			switch rune_ {
+			case '{':
+				inVariable = true
+				builder.WriteString(`(?P<`)
+
+			case '}':
+				return nil, fmt.Errorf("host template contains \"}\" without a \"{\" before it: %s", host)
+
+			case '*':
+				builder.WriteString(`.+`)
+
+			default:
+				builder.WriteString(regexp.QuoteMeta(string(rune_)))
+			}
+		}
+	}
+
+	if inVariable {
+		return nil, fmt.Errorf("host template contains \"{\" without a \"}\" after it: %s", host)
+	}
+
+	builder.WriteRune('$')
+
+	if re, err := regexp.Compile(builder.String()); err == nil {
+		return &HostTemplate{
+			Template:          host,
+			RegularExpression: re,
+		}, nil
+	} else {
+		return nil, err
+	}
+}
+
+func (self *HostTemplate) Match(host string) map[string]string {
+	if self.RegularExpression == nil {
+		// Empty template always matches
+		return make(map[string]string)
+	}
+
+	if matches := self.RegularExpression.FindStringSubmatch(strings.ToLower(host)); matches != nil {
+		names := self.RegularExpression.SubexpNames()
+		map_ := make(map[string]string)
+		for index, match := range matches {
+			if (index > 0) && (names[index] != "") {
+				map_[names[index]] = match
+			}
+		}
+		return map_
+	}
+
+	return nil
+}
+
+// ([fmt.Stringify] interface)
+func (self *HostTemplate) String() string {
+	if self.RegularExpression != nil {
+		return self.RegularExpression.String()
+	} else {
+		return ""
+	}
+}
+
+//
+// HostTemplates
+//
+// Matches any single template (in sequence)
+//
+
+type HostTemplates []*HostTemplate
+
+func NewHostTemplates(hosts ...string) (HostTemplates, error) {
+	self := make(HostTemplates, len(hosts))
+	for index, host := range hosts {
+		if hostTemplate, err := NewHostTemplate(host); err == nil {
+			self[index] = hostTemplate
+		} else {
+			return nil, err
+		}
+	}
+	return self, nil
+}
+
+func (self HostTemplates) MatchAny(host string) map[string]string {
+	if len(self) == 0 {
+		// Empty templates always match
+		return make(map[string]string)
+	}
+
+	for _, hostTemplate := range self {
+		if matches := hostTemplate.Match(host); matches != nil {
+			return matches
+		}
+	}
+
+	return nil
+}
+
+// ([fmt.Stringify] interface)
+func (self HostTemplates) String() string {
+	var builder strings.Builder
+	var last = len(self) - 1
+	for index, hostTemplate := range self {
+		builder.WriteString(hostTemplate.String())
+		if index != last {
+			builder.WriteString(", ")
+		}
+	}
+	return builder.String()
+}
@@ -0,0 +1,67 @@
+package rest
+
+import (
+	"crypto/tls"
+	"net"
+	"net/http"
+
+	"github.com/quic-go/quic-go/http3"
+	"github.com/tliron/commonlog"
+)
+
+// Listens on UDP at the same address and port as the TCP listener, sharing
+// the handler and the TLS configuration
+func (self *Server) startHttp3(handler http.Handler, tlsConfig *tls.Config) (*http3.Server, error) {
+	log := commonlog.NewKeyValueLogger(self.log, "_scope", "http3")
+
+	if packetConn, err := net.ListenPacket(self.network("udp"), self.AddressPort()); err == nil {
+		http3Server := &http3.Server{
+			Addr:      self.AddressPort(),
+			Port:      int(self.Port),
+			TLSConfig: tlsConfig,
+			Handler:   handler,
+		}
+
+		self.serverLock.Lock()
+		self.http3Server = http3Server
+		self.serverLock.Unlock()
+
+		go func() {
+			defer commonlog.CallAndLogWarning(packetConn.Close, "Server.startHttp3", log)
+
+			log.Info("starting")
+			if err := http3Server.Serve(packetConn); (err != nil) && (err != http.ErrServerClosed) {
+				log.Error(err.Error())
+			}
+		}()
+
+		return http3Server, nil
+	} else {
+		return nil, err
+	}
+}
+
+//
+// altSvcHandler
+//
+
+type altSvcHandler struct {
+	http3Server *http3.Server
+	handler     http.Handler
+}
+
+func newAltSvcHandler(http3Server *http3.Server, handler http.Handler) *altSvcHandler {
+	return &altSvcHandler{
+		http3Server: http3Server,
+		handler:     handler,
+	}
+}
+
+// ([http.Handler] interface)
+func (self *altSvcHandler) ServeHTTP(responseWriter http.ResponseWriter, request *http.Request) {
+	// Alt-Svc
+	// https://developer.mozilla.org/en-US/docs/Web/HTTP/Headers/Alt-Svc
+	// (Will fail harmlessly if the HTTP/3 listener is not ready yet)
+	self.http3Server.SetQuicHeaders(responseWriter.Header())
+	self.handler.ServeHTTP(responseWriter, request)
+}
@@ -0,0 +1,114 @@
+package rest
+
+import (
+	"bufio"
+	"net"
+	"net/http"
+	"time"
+
+	"gocloud.dev/server/requestlog"
+)
+
+//
+// ncsaHandler
+//
+// Like [requestlog.Handler], but our writer can be unwrapped by
+// [http.ResponseController], so that handlers can still clear the connection's
+// deadlines (e.g. for event streams and WebSockets).
+//
+
+type ncsaHandler struct {
+	logger  *requestlog.NCSALogger
+	handler http.Handler
+}
+
+func newNcsaHandler(logger *requestlog.NCSALogger, handler http.Handler) *ncsaHandler {
+	return &ncsaHandler{
+		logger:  logger,
+		handler: handler,
+	}
+}
+
+// ([http.Handler] interface)
+func (self *ncsaHandler) ServeHTTP(responseWriter http.ResponseWriter, request *http.Request) {
+	entry := newNcsaEntry(request, time.Now())
+	writer := ncsaWriter{writer: responseWriter}
+
+	self.handler.ServeHTTP(&writer, request)
+
+	entry.Status = writer.status
+	if entry.Status == 0 {
+		entry.Status = http.StatusOK
+	}
+	entry.ResponseBodySize = writer.size
+	entry.Latency = time.Since(entry.ReceivedTime)
+	self.logger.Log(entry)
+}
+
+// The NCSA logger uses the deprecated fields rather than the request
+func newNcsaEntry(request *http.Request, receivedTime time.Time) *requestlog.Entry {
+	entry := requestlog.Entry{
+		Request:       request,
+		ReceivedTime:  receivedTime,
+		RequestMethod: request.Method,
+		RequestURL:    request.URL.String(),
+		Proto:         request.Proto,
+		Referer:       request.Referer(),
+		UserAgent:     request.UserAgent(),
+	}
+
+	if host, _, err := net.SplitHostPort(request.RemoteAddr); err == nil {
+		entry.RemoteIP = host
+	}
+
+	return &entry
+}
+
+//
+// ncsaWriter
+//
+
+type ncsaWriter struct {
+	writer http.ResponseWriter
+	status int
+	size   int64
+}
+
+// ([http.ResponseWriter] interface)
+func (self *ncsaWriter) Header() http.Header {
+	return self.writer.Header()
+}
+
+// ([http.ResponseWriter] interface)
+func (self *ncsaWriter) WriteHeader(statusCode int) {
+	// Informational statuses (e.g. 103 Early Hints) are not final
+	if (self.status == 0) && (statusCode >= 200) {
+		self.status = statusCode
+	}
+	self.writer.WriteHeader(statusCode)
+}
+
+// ([http.ResponseWriter] interface, [io.Writer] interface)
+func (self *ncsaWriter) Write(bytes []byte) (int, error) {
+	if self.status == 0 {
+		self.status = http.StatusOK
+	}
+	n, err := self.writer.Write(bytes)
+	self.size += int64(n)
+	return n, err
+}
+
+// ([http.Flusher] interface)
+func (self *ncsaWriter) Flush() {
+	http.NewResponseController(self.writer).Flush()
+}
+
+// ([http.Hijacker] interface)
+func (self *ncsaWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	return http.NewResponseController(self.writer).Hijack()
+}
+
+// (used by [http.ResponseController], e.g. for setting deadlines)
+func (self *ncsaWriter) Unwrap() http.ResponseWriter {
+	return self.writer
+}
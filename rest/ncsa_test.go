@@ -0,0 +1,77 @@
+package rest
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"gocloud.dev/server/requestlog"
+)
+
+func TestNcsaHandlerDeadlines(t *testing.T) {
+	var log bytes.Buffer
+	var lock sync.Mutex
+	logger := requestlog.NewNCSALogger(writerFunc(func(p []byte) (int, error) {
+		lock.Lock()
+		defer lock.Unlock()
+		return log.Write(p)
+	}), func(err error) {
+		t.Error(err)
+	})
+
+	// Same order as in Server.Start
+	var handler http.Handler = http.HandlerFunc(func(responseWriter http.ResponseWriter, request *http.Request) {
+		responseController := http.NewResponseController(responseWriter)
+		if err := responseController.SetReadDeadline(time.Time{}); err != nil {
+			t.Errorf("cannot clear read deadline: %s", err)
+		}
+		if err := responseController.SetWriteDeadline(time.Time{}); err != nil {
+			t.Errorf("cannot clear write deadline: %s", err)
+		}
+
+		responseWriter.WriteHeader(http.StatusAccepted)
+		io.WriteString(responseWriter, "ok")
+	})
+	handler = newNcsaHandler(logger, handler)
+	handler = newTimeoutHandler(handler, time.Second)
+
+	server := httptest.NewServer(handler)
+	defer server.Close()
+
+	request, err := http.NewRequest(http.MethodGet, server.URL+"/path?x=1", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	request.Header.Set("User-Agent", "test")
+
+	response, err := http.DefaultClient.Do(request)
+	if err != nil {
+		t.Fatal(err)
+	}
+	io.Copy(io.Discard, response.Body)
+	response.Body.Close()
+
+	if response.StatusCode != http.StatusAccepted {
+		t.Errorf("expected status %d, got %d", http.StatusAccepted, response.StatusCode)
+	}
+
+	lock.Lock()
+	line := log.String()
+	lock.Unlock()
+
+	if !strings.HasPrefix(line, "127.0.0.1 - - [") || !strings.HasSuffix(line, "] \"GET /path?x=1 HTTP/1.1\" 202 2 \"\" \"test\"\n") {
+		t.Errorf("wrong log line: %q", line)
+	}
+}
+
+type writerFunc func(p []byte) (int, error)
+
+// ([io.Writer] interface)
+func (self writerFunc) Write(p []byte) (int, error) {
+	return self(p)
+}
@@ -3,6 +3,7 @@ package rest
 import (
 	"fmt"
 	"regexp"
+	"strconv"
 	"strings"
 )
 
@@ -19,17 +20,28 @@ const (
 // Variables are wrapped in "{" and "}" and do not extend beyond a slash, unless "*"
 // appears before the "}".
 //
+// Variables can have a type following a ":", e.g. "{id:int}", in which case they will
+// only match values of that type and will be converted accordingly (see
+// [PathVariableTypes]). A custom regular expression can be provided via "regex(...)",
+// e.g. "{code:regex([a-z]{3})}".
+//
 // The "*" wildcard matches any characters into the "__path" variable. It can only be
 // used once per path.
 //
+// Parts wrapped in "[" and "]" are optional, e.g. "posts[/{page:int}]". Variables in
+// optional parts that are absent will not be extracted.
+//
+// Special characters can be escaped with a "\", e.g. "\{" for a literal "{".
+//
 
 type PathTemplate struct {
 	Template                               string
 	RegularExpression                      *regexp.Regexp
 	RedirectTrailingSlashRegularExpression *regexp.Regexp
+	Converters                             map[string]PathVariableConverter // by variable name
 }
 
-var PathTemplateAll = &PathTemplate{"", nil, nil}
+var PathTemplateAll = &PathTemplate{"", nil, nil, nil}
 
 func NewPathTemplate(path string) (*PathTemplate, error) {
 	if path == "" {
@@ -38,78 +50,78 @@ func NewPathTemplate(path string) (*PathTemplate, error) {
 	}
 
 	var builder strings.Builder
-	var inVariable bool
 	var containsWildcard bool
-	var variableContainsWildcard bool
 	var redirectTrailingSlash string
-	var skipNext bool
+	var optionalDepth int
+	converters := make(map[string]PathVariableConverter)
 
 	builder.WriteRune('^')
 
 	runes := []rune(path)
-	last := len(runes) - 1
-	for index, rune_ := range runes {
-		// TODO alow escaping
+	length := len(runes)
+	for index := 0; index < length; index++ {
+		switch rune_ := runes[index]; rune_ {
+		case '\\':
+			if index++; index == length {
+				return nil, fmt.Errorf("path template ends with an escape character: %s", path)
+			}
+			builder.WriteString(regexp.QuoteMeta(string(runes[index])))
 
-		if skipNext {
-			skipNext = false
-			continue
-		}
+		case '{':
+			var name, regex string
+			var converter PathVariableConverter
+			var err error
+			if name, regex, converter, index, err = parsePathVariable(path, runes, index+1); err != nil {
+				return nil, err
+			}
+			builder.WriteString(`(?P<` + name + `>` + regex + `)`)
+			if converter != nil {
+				converters[name] = converter
+			}
 
-		if inVariable {
-			switch rune_ {
-			case '}':
-				if variableContainsWildcard {
-					builder.WriteString(`>.*)`)
-					variableContainsWildcard = false
-				} else {
-					builder.WriteString(`>[^/]*)`)
-				}
-				inVariable = false
+		case '}':
+			return nil, fmt.Errorf("path template contains \"}\" without a \"{\" before it: %s", path)
 
-			case '*':
-				variableContainsWildcard = true
+		case '*':
+			if containsWildcard {
+				return nil, fmt.Errorf("path template contains more than one \"*\": %s", path)
+			}
+			builder.WriteString(PathVariableRe)
+			containsWildcard = true
 
-			default:
-				if variableContainsWildcard {
-					return nil, fmt.Errorf("variable name in path template has \"*\" but not as last character: %s", path)
-				}
+		case '[':
+			builder.WriteString(`(?:`)
+			optionalDepth++
 
-				// Group name
-				builder.WriteRune(rune_)
+		case ']':
+			if optionalDepth == 0 {
+				return nil, fmt.Errorf("path template contains \"]\" without a \"[\" before it: %s", path)
 			}
-		} else {
-			switch rune_ {
-			case '{':
-				inVariable = true
-				builder.WriteString(`(?P<`)
+			builder.WriteString(`)?`)
+			optionalDepth--
 
-			case '}':
-				return nil, fmt.Errorf("path template contains \"}\" without a \"{\" before it: %s", path)
-
-			case '*':
-				if containsWildcard {
-					return nil, fmt.Errorf("path template contains more than one \"*\": %s", path)
+		case '/':
+			if (index < length-1) && (runes[index+1] == '/') {
+				if redirectTrailingSlash != "" {
+					return nil, fmt.Errorf("path template contains more than \"//\": %s", path)
 				}
-				builder.WriteString(PathVariableRe)
-				containsWildcard = true
-
-			case '/':
-				if (index < last) && (runes[index+1] == '/') {
-					if redirectTrailingSlash != "" {
-						return nil, fmt.Errorf("path template contains more than \"//\": %s", path)
-					}
-					redirectTrailingSlash = builder.String() + "$"
-					skipNext = true
+				if optionalDepth > 0 {
+					return nil, fmt.Errorf("path template contains \"//\" in an optional part: %s", path)
 				}
-				builder.WriteRune('/')
-
-			default:
-				builder.WriteString(regexp.QuoteMeta(string(rune_)))
+				redirectTrailingSlash = builder.String() + "$"
+				index++
 			}
+			builder.WriteRune('/')
+
+		default:
+			builder.WriteString(regexp.QuoteMeta(string(rune_)))
 		}
 	}
 
+	if optionalDepth > 0 {
+		return nil, fmt.Errorf("path template contains \"[\" without a \"]\" after it: %s", path)
+	}
+
 	builder.WriteRune('$')
 
 	if re, err := regexp.Compile(builder.String()); err == nil {
@@ -124,24 +136,45 @@ func NewPathTemplate(path string) (*PathTemplate, error) {
 			Template:                               path,
 			RegularExpression:                      re,
 			RedirectTrailingSlashRegularExpression: redirectTrailingSlashRe,
+			Converters:                             converters,
 		}, nil
 	} else {
 		return nil, err
 	}
 }
 
-func (self *PathTemplate) Match(path string) map[string]string {
+// Values of typed variables are converted. Returns nil if a conversion
+// fails, e.g. for an integer that is too big.
+func (self *PathTemplate) Match(path string) map[string]any {
 	if self.RegularExpression == nil {
 		// Empty template always matches
-		return make(map[string]string)
+		return make(map[string]any)
 	}
 
-	if matches := self.RegularExpression.FindStringSubmatch(path); matches != nil {
-		names := self.RegularExpression.SubexpNames()
-		map_ := make(map[string]string)
-		for index, match := range matches {
-			if index > 0 {
-				map_[names[index]] = match
+	if matches := self.RegularExpression.FindStringSubmatchIndex(path); matches != nil {
+		map_ := make(map[string]any)
+		for index, name := range self.RegularExpression.SubexpNames() {
+			if (index == 0) || (name == "") {
+				continue
+			}
+
+			start := matches[index*2]
+			if start == -1 {
+				// In an absent optional part
+				if name == PathVariable {
+					map_[name] = ""
+				}
+				continue
+			}
+
+			value := path[start:matches[index*2+1]]
+			if convert, ok := self.Converters[name]; ok {
+				var err error
+				if map_[name], err = convert(value); err != nil {
+					return nil
+				}
+			} else {
+				map_[name] = value
 			}
 		}
 		return map_
@@ -187,7 +220,7 @@ func NewPathTemplates(paths ...string) (PathTemplates, error) {
 	return self, nil
 }
 
-func (self PathTemplates) MatchAny(path string) map[string]string {
+func (self PathTemplates) MatchAny(path string) map[string]any {
 	for _, pathTemplate := range self {
 		if matches := pathTemplate.Match(path); matches != nil {
 			return matches
@@ -219,3 +252,112 @@ func (self PathTemplates) String() string {
 	}
 	return builder.String()
 }
+
+//
+// PathVariableType
+//
+
+type PathVariableConverter func(value string) (any, error)
+
+type PathVariableType struct {
+	RegularExpression string
+	Converter         PathVariableConverter // can be nil
+}
+
+// Supported types for path template variables. You may add your own.
+var PathVariableTypes = map[string]PathVariableType{
+	"int": {`-?[0-9]+`, func(value string) (any, error) {
+		return strconv.ParseInt(value, 10, 64)
+	}},
+	"uint": {`[0-9]+`, func(value string) (any, error) {
+		return strconv.ParseUint(value, 10, 64)
+	}},
+	"float": {`-?[0-9]+(?:\.[0-9]+)?`, func(value string) (any, error) {
+		return strconv.ParseFloat(value, 64)
+	}},
+	"bool": {`true|false`, func(value string) (any, error) {
+		return value == "true", nil
+	}},
+	"uuid": {`[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}`, func(value string) (any, error) {
+		return strings.ToLower(value), nil
+	}},
+	"alpha": {`[a-zA-Z]+`, nil},
+	"alnum": {`[a-zA-Z0-9]+`, nil},
+	"slug":  {`[a-zA-Z0-9]+(?:[-_][a-zA-Z0-9]+)*`, nil},
+}
+
+// Parses from after the "{" until the "}" and returns the index of the "}".
+func parsePathVariable(path string, runes []rune, index int) (string, string, PathVariableConverter, int, error) {
+	start := index
+	for length := len(runes); index < length; index++ {
+		switch runes[index] {
+		case '}':
+			return string(runes[start:index]), `[^/]*`, nil, index, nil
+
+		case '*':
+			if (index < length-1) && (runes[index+1] == '}') {
+				return string(runes[start:index]), `.*`, nil, index + 1, nil
+			}
+			return "", "", nil, 0, fmt.Errorf("variable name in path template has \"*\" but not as last character: %s", path)
+
+		case ':':
+			name := string(runes[start:index])
+			regex, converter, index, err := parsePathVariableType(path, runes, index+1)
+			return name, regex, converter, index, err
+		}
+	}
+
+	return "", "", nil, 0, fmt.Errorf("path template contains \"{\" without a \"}\" after it: %s", path)
+}
+
+// Parses from after the ":" until the "}" and returns the index of the "}".
+func parsePathVariableType(path string, runes []rune, index int) (string, PathVariableConverter, int, error) {
+	start := index
+	for length := len(runes); index < length; index++ {
+		switch runes[index] {
+		case '}':
+			name := string(runes[start:index])
+			if type_, ok := PathVariableTypes[name]; ok {
+				return `(?:` + type_.RegularExpression + `)`, type_.Converter, index, nil
+			}
+			return "", nil, 0, fmt.Errorf("unsupported variable type in path template: %s", name)
+
+		case '(':
+			if name := string(runes[start:index]); name != "regex" {
+				return "", nil, 0, fmt.Errorf("unsupported variable type in path template: %s", name)
+			}
+
+			end := findClosingParenthesis(runes, index+1)
+			if end == -1 {
+				return "", nil, 0, fmt.Errorf("variable regex in path template contains \"(\" without a \")\" after it: %s", path)
+			}
+			if (end == length-1) || (runes[end+1] != '}') {
+				return "", nil, 0, fmt.Errorf("variable regex in path template is not followed by \"}\": %s", path)
+			}
+
+			return `(?:` + string(runes[index+1:end]) + `)`, nil, end + 1, nil
+		}
+	}
+
+	return "", nil, 0, fmt.Errorf("path template contains \"{\" without a \"}\" after it: %s", path)
+}
+
+// Skips escaped characters and nested parentheses.
+func findClosingParenthesis(runes []rune, index int) int {
+	depth := 1
+	for length := len(runes); index < length; index++ {
+		switch runes[index] {
+		case '\\':
+			index++
+
+		case '(':
+			depth++
+
+		case ')':
+			if depth--; depth == 0 {
+				return index
+			}
+		}
+	}
+	return -1
+}
@@ -0,0 +1,101 @@
+package rest
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestNewPathTemplate(t *testing.T) {
+	tests := []struct {
+		template string
+		path     string
+		expected map[string]any // nil if not matching
+	}{
+		// Plain
+		{"", "anything", map[string]any{}},
+		{"about", "about", map[string]any{}},
+		{"about", "about/", nil},
+		{"a.b", "axb", nil},
+
+		// Variables
+		{"users/{name}", "users/linus", map[string]any{"name": "linus"}},
+		{"users/{name}", "users/linus/posts", nil},
+		{"files/{path*}", "files/a/b/c", map[string]any{"path": "a/b/c"}},
+		{"static/*", "static/a/b", map[string]any{"__path": "a/b"}},
+
+		// Escapes
+		{`a\{b\}`, "a{b}", map[string]any{}},
+		{`a\[b\]`, "a[b]", map[string]any{}},
+		{`a\*`, "a*", map[string]any{}},
+		{`a\*`, "ab", nil},
+		{`a\\{name}`, `a\linus`, map[string]any{"name": "linus"}},
+
+		// Typed variables
+		{"items/{id:int}", "items/-12", map[string]any{"id": int64(-12)}},
+		{"items/{id:int}", "items/abc", nil},
+		{"items/{id:uint}", "items/12", map[string]any{"id": uint64(12)}},
+		{"items/{id:uint}", "items/-12", nil},
+		{"items/{x:float}", "items/1.5", map[string]any{"x": 1.5}},
+		{"items/{b:bool}", "items/true", map[string]any{"b": true}},
+		{"items/{u:uuid}", "items/123E4567-E89B-12D3-A456-426614174000", map[string]any{"u": "123e4567-e89b-12d3-a456-426614174000"}},
+		{"items/{s:slug}", "items/hello-world_2", map[string]any{"s": "hello-world_2"}},
+		{"items/{s:slug}", "items/-hello", nil},
+
+		// Overflowing integers do not match
+		{"items/{id:int}", "items/9223372036854775807", map[string]any{"id": int64(9223372036854775807)}},
+		{"items/{id:int}", "items/9223372036854775808", nil},
+		{"items/{id:uint}", "items/18446744073709551616", nil},
+
+		// Regular expressions, including "}" and nested parentheses
+		{"codes/{code:regex([a-z]{3})}", "codes/abc", map[string]any{"code": "abc"}},
+		{"codes/{code:regex([a-z]{3})}", "codes/abcd", nil},
+		{"codes/{code:regex((a|b)(c|d))}", "codes/bd", map[string]any{"code": "bd"}},
+		{`codes/{code:regex(x\)y)}`, "codes/x)y", map[string]any{"code": "x)y"}},
+		{"codes/{code:regex(a{1,2})}/{n:int}", "codes/aa/3", map[string]any{"code": "aa", "n": int64(3)}},
+
+		// Optional parts
+		{"posts[/{page:int}]", "posts", map[string]any{}},
+		{"posts[/{page:int}]", "posts/2", map[string]any{"page": int64(2)}},
+		{"posts[/{page:int}]", "posts/", nil},
+		{"a[/{b}[/{c}]]", "a", map[string]any{}},
+		{"a[/{b}[/{c}]]", "a/x", map[string]any{"b": "x"}},
+		{"a[/{b}[/{c}]]", "a/x/y", map[string]any{"b": "x", "c": "y"}},
+		{"a[/*]", "a", map[string]any{"__path": ""}},
+	}
+
+	for _, test := range tests {
+		pathTemplate, err := NewPathTemplate(test.template)
+		if err != nil {
+			t.Errorf("%q: %s", test.template, err)
+			continue
+		}
+
+		if matches := pathTemplate.Match(test.path); !reflect.DeepEqual(matches, test.expected) {
+			t.Errorf("%q matching %q: expected %#v, got %#v", test.template, test.path, test.expected, matches)
+		}
+	}
+}
+
+func TestNewPathTemplateErrors(t *testing.T) {
+	for _, template := range []string{
+		`a\`,
+		"a}",
+		"a{b",
+		"a{b*c}",
+		"*/*",
+		"a]",
+		"a[b",
+		"a[b//c]",
+		"a//b//c",
+		"a/{b:nosuchtype}",
+		"a/{b:regex([a-z]}",
+		"a/{b:regex([a-z])x}",
+		"a/{b:int",
+		"a/{b:regex(()}",
+		"a/{b:regex([a-z)}",
+	} {
+		if _, err := NewPathTemplate(template); err == nil {
+			t.Errorf("%q: expected an error", template)
+		}
+	}
+}
@@ -0,0 +1,507 @@
+package rest
+
+import (
+	contextpkg "context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httputil"
+	urlpkg "net/url"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/tliron/commonjs-goja"
+	"github.com/tliron/go-ard"
+	"github.com/tliron/prudence/platform"
+)
+
+const (
+	DEFAULT_PROXY_HEALTH_CHECK_INTERVAL = 10 * time.Second
+	DEFAULT_PROXY_HEALTH_CHECK_TIMEOUT  = 5 * time.Second
+)
+
+//
+// Proxy
+//
+
+type Proxy struct {
+	Upstreams       []*ProxyUpstream
+	Path            string            // can contain "{variable}", empty to use the request path
+	PreserveHost    bool              // otherwise "Host" is the upstream's
+	RequestHeaders  map[string]string // values can contain "{variable}", empty value to remove
+	ResponseHeaders map[string]string // values can contain "{variable}", empty value to remove
+
+	HealthCheckPath     string // empty to disable health checks
+	HealthCheckInterval time.Duration
+	HealthCheckTimeout  time.Duration
+
+	CacheDuration float64  // seconds, 0 to disable caching
+	CacheGroups   []string // can contain "{variable}"
+	CacheVary     []string // names of request headers
+
+	transport *http.Transport
+	next      atomic.Uint64
+	stop      chan struct{}
+	stopLock  sync.Mutex
+}
+
+func NewProxy(upstreams ...*ProxyUpstream) *Proxy {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	// We want to handle encoding ourselves
+	transport.DisableCompression = true
+
+	return &Proxy{
+		Upstreams:           upstreams,
+		HealthCheckInterval: DEFAULT_PROXY_HEALTH_CHECK_INTERVAL,
+		HealthCheckTimeout:  DEFAULT_PROXY_HEALTH_CHECK_TIMEOUT,
+		transport:           transport,
+	}
+}
+
+// ([platform.CreateFunc] signature)
+func CreateProxy(jsContext *commonjs.Context, config ard.StringMap) (any, error) {
+	config_ := ard.With(config).ConvertSimilar().NilMeansZero()
+
+	self := NewProxy()
+
+	for _, url := range platform.AsStringList(config_.Get("upstreams")) {
+		if upstream, err := NewProxyUpstream(url); err == nil {
+			self.Upstreams = append(self.Upstreams, upstream)
+		} else {
+			return nil, err
+		}
+	}
+	if len(self.Upstreams) == 0 {
+		return nil, errors.New("Proxy \"upstreams\" must be set")
+	}
+
+	self.Path, _ = config_.Get("path").String()
+	self.PreserveHost, _ = config_.Get("preserveHost").Boolean()
+
+	var err error
+	if self.RequestHeaders, err = getProxyHeaders(config_.Get("requestHeaders")); err != nil {
+		return nil, err
+	}
+	if self.ResponseHeaders, err = getProxyHeaders(config_.Get("responseHeaders")); err != nil {
+		return nil, err
+	}
+
+	if timeout, ok := config_.Get("timeout").Float(); ok {
+		self.transport.ResponseHeaderTimeout = time.Duration(timeout * float64(time.Second))
+	}
+
+	if healthCheck := config_.Get("healthCheck"); healthCheck.Value != nil {
+		if path, ok := healthCheck.String(); ok {
+			self.HealthCheckPath = path
+		} else {
+			self.HealthCheckPath, _ = healthCheck.Get("path").String()
+			if interval, ok := healthCheck.Get("interval").Float(); ok {
+				self.HealthCheckInterval = time.Duration(interval * float64(time.Second))
+			}
+			if timeout, ok := healthCheck.Get("timeout").Float(); ok {
+				self.HealthCheckTimeout = time.Duration(timeout * float64(time.Second))
+			}
+		}
+	}
+
+	self.CacheDuration, _ = config_.Get("cacheDuration").Float()
+	self.CacheGroups = platform.AsStringList(config_.Get("cacheGroups"))
+	self.CacheVary = platform.AsStringList(config_.Get("cacheVary"))
+
+	return self, nil
+}
+
+// ([Handler] interface, [HandleFunc] signature)
+func (self *Proxy) Handle(restContext *Context) (bool, error) {
+	upstream := self.nextUpstream()
+	if upstream == nil {
+		restContext.Log.Warning("no healthy upstreams")
+		restContext.Response.Status = http.StatusBadGateway
+		return true, nil
+	}
+
+	target := self.target(restContext, upstream)
+	restContext.Log.Debugf("proxying to: %s", target)
+
+	upgrade := restContext.Request.Header.Get(HeaderUpgrade) != ""
+
+	if (self.CacheDuration > 0.0) && (restContext.Request.Method == http.MethodGet) && !upgrade && !self.hasCredentials(restContext.Request) {
+		return true, self.handleCached(restContext, target)
+	}
+
+	if upgrade {
+		// The hijacked connection would otherwise keep the server's deadlines
+		responseController := http.NewResponseController(restContext.Response.Direct)
+		if err := responseController.SetReadDeadline(time.Time{}); err != nil {
+			restContext.Log.Debugf("cannot clear read deadline: %s", err.Error())
+		}
+		if err := responseController.SetWriteDeadline(time.Time{}); err != nil {
+			restContext.Log.Debugf("cannot clear write deadline: %s", err.Error())
+		}
+	}
+
+	// The reverse proxy writes the response itself
+	restContext.Response.Bypass = true
+	self.newReverseProxy(restContext, target, false).ServeHTTP(restContext.Response.Direct, restContext.Request.Direct)
+
+	return true, nil
+}
+
+func (self *Proxy) handleCached(restContext *Context, target *urlpkg.URL) error {
+	restContext.CacheKey = self.Upstreams[0].URL.String() + target.RequestURI()
+	restContext.CacheDuration = self.CacheDuration
+	restContext.CacheVary = self.CacheVary
+	restContext.CacheGroups = make([]string, len(self.CacheGroups))
+	for index, group := range self.CacheGroups {
+		restContext.CacheGroups[index] = restContext.expandVariables(group)
+	}
+
+	if key, cached, ok := restContext.LoadCachedRepresentation(); ok && !cached.Expired() && (len(cached.Body) > 0) {
+		if changed := restContext.PresentCachedRepresentation(cached, true); changed {
+			restContext.UpdateCachedRepresentation(key, cached)
+		}
+		return nil
+	}
+
+	cached, err := restContext.Coalesce(true, func() error {
+		writer := proxyResponseWriter{restContext: restContext, cacheVary: self.CacheVary}
+		reverseProxy := self.newReverseProxy(restContext, target, true)
+		reverseProxy.ServeHTTP(&writer, restContext.Request.Direct)
+
+		if err := restContext.Flush(); err != nil {
+			return err
+		}
+
+		if (restContext.Response.Status != http.StatusOK) || writer.uncacheable {
+			// Don't cache errors or responses the upstream does not allow us to share
+			restContext.CacheDuration = 0.0
+			return nil
+		}
+
+		restContext.setCacheControl()
+		restContext.setVary()
+		restContext.setSurrogateKeys()
+		restContext.StoreCachedRepresentation(true)
+
+		return nil
+	})
+
+	if err != nil {
+		return err
+	}
+
+	if cached != nil {
+		restContext.PresentCachedRepresentation(cached, true)
+	}
+
+	return nil
+}
+
+func (self *Proxy) newReverseProxy(restContext *Context, target *urlpkg.URL, caching bool) *httputil.ReverseProxy {
+	return &httputil.ReverseProxy{
+		Transport:     self.transport,
+		FlushInterval: -1, // we want streaming to work (flushing also ends the server's handler timeout)
+
+		Rewrite: func(request *httputil.ProxyRequest) {
+			request.Out.URL = target
+			if self.PreserveHost {
+				request.Out.Host = request.In.Host
+			} else {
+				request.Out.Host = ""
+			}
+			request.SetXForwarded()
+
+			if caching {
+				// We will encode it ourselves
+				request.Out.Header.Del(HeaderAcceptEncoding)
+				// We want a full response that we can cache
+				request.Out.Header.Del(HeaderIfNoneMatch)
+				request.Out.Header.Del(HeaderIfModifiedSince)
+			}
+
+			setProxyHeaders(restContext, request.Out.Header, self.RequestHeaders)
+		},
+
+		ModifyResponse: func(response *http.Response) error {
+			setProxyHeaders(restContext, response.Header, self.ResponseHeaders)
+			return nil
+		},
+
+		ErrorHandler: func(writer http.ResponseWriter, request *http.Request, err error) {
+			if !errors.Is(err, contextpkg.Canceled) {
+				restContext.Log.Warningf("upstream error: %s", err.Error())
+			}
+			writer.WriteHeader(http.StatusBadGateway)
+		},
+	}
+}
+
+// Credentials mean that the response might be meant only for this client,
+// unless we vary the cache on them.
+func (self *Proxy) hasCredentials(request *Request) bool {
+	for _, name := range []string{HeaderAuthorization, HeaderCookie} {
+		if (request.Header.Get(name) != "") && !containsHeaderName(self.CacheVary, name) {
+			return true
+		}
+	}
+	return false
+}
+
+func (self *Proxy) target(restContext *Context, upstream *ProxyUpstream) *urlpkg.URL {
+	path := restContext.Request.Path
+	if self.Path != "" {
+		path = restContext.expandVariables(self.Path)
+	}
+
+	target := *upstream.URL
+	target.Path = strings.TrimSuffix(target.Path, "/") + "/" + strings.TrimPrefix(path, "/")
+	target.RawPath = ""
+	target.RawQuery = restContext.Request.Direct.URL.RawQuery
+	return &target
+}
+
+// Round robin over the healthy upstreams. Returns nil if there are none.
+func (self *Proxy) nextUpstream() *ProxyUpstream {
+	length := uint64(len(self.Upstreams))
+	if length == 0 {
+		return nil
+	}
+
+	start := self.next.Add(1)
+	for index := uint64(0); index < length; index++ {
+		if upstream := self.Upstreams[(start+index)%length]; upstream.Healthy() {
+			return upstream
+		}
+	}
+
+	return nil
+}
+
+// ([platform.Startable] interface)
+func (self *Proxy) Start() error {
+	if self.HealthCheckPath == "" {
+		return nil
+	}
+
+	self.stopLock.Lock()
+	defer self.stopLock.Unlock()
+
+	if self.stop != nil {
+		return nil
+	}
+
+	self.stop = make(chan struct{})
+	go self.checkHealth(self.stop)
+
+	return nil
+}
+
+// ([platform.Startable] interface)
+func (self *Proxy) Stop(stopContext contextpkg.Context) error {
+	self.stopLock.Lock()
+	defer self.stopLock.Unlock()
+
+	if self.stop != nil {
+		close(self.stop)
+		self.stop = nil
+	}
+
+	return nil
+}
+
+func (self *Proxy) checkHealth(stop chan struct{}) {
+	client := http.Client{
+		Transport: self.transport,
+		Timeout:   self.HealthCheckTimeout,
+		CheckRedirect: func(request *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+
+	ticker := time.NewTicker(self.HealthCheckInterval)
+	defer ticker.Stop()
+
+	for {
+		for _, upstream := range self.Upstreams {
+			upstream.check(&client, self.HealthCheckPath)
+		}
+
+		select {
+		case <-ticker.C:
+		case <-stop:
+			return
+		}
+	}
+}
+
+func getProxyHeaders(node *ard.Node) (map[string]string, error) {
+	if node.Value == nil {
+		return nil, nil
+	}
+
+	if headers, ok := node.StringMap(); ok {
+		headers_ := make(map[string]string)
+		for name, value := range headers {
+			if value == nil {
+				headers_[name] = ""
+			} else {
+				headers_[name] = fmt.Sprintf("%v", value)
+			}
+		}
+		return headers_, nil
+	} else {
+		return nil, fmt.Errorf("proxy headers not a map: %T", node.Value)
+	}
+}
+
+func setProxyHeaders(restContext *Context, header http.Header, headers map[string]string) {
+	for name, value := range headers {
+		if value == "" {
+			header.Del(name)
+		} else {
+			header.Set(name, restContext.expandVariables(value))
+		}
+	}
+}
+
+//
+// ProxyUpstream
+//
+
+type ProxyUpstream struct {
+	URL *urlpkg.URL
+
+	unhealthy atomic.Bool
+}
+
+func NewProxyUpstream(url string) (*ProxyUpstream, error) {
+	if url_, err := urlpkg.Parse(url); err == nil {
+		if (url_.Scheme == "") || (url_.Host == "") {
+			return nil, fmt.Errorf("upstream URL is not absolute: %s", url)
+		}
+		return &ProxyUpstream{URL: url_}, nil
+	} else {
+		return nil, err
+	}
+}
+
+func (self *ProxyUpstream) Healthy() bool {
+	return !self.unhealthy.Load()
+}
+
+func (self *ProxyUpstream) check(client *http.Client, path string) {
+	url := *self.URL
+	url.Path = strings.TrimSuffix(url.Path, "/") + "/" + strings.TrimPrefix(path, "/")
+	url.RawPath = ""
+
+	healthy := false
+	if response, err := client.Get(url.String()); err == nil {
+		io.Copy(io.Discard, response.Body)
+		response.Body.Close()
+		healthy = response.StatusCode < 400
+	} else {
+		log.Debugf("health check error: %s", err.Error())
+	}
+
+	if wasUnhealthy := self.unhealthy.Swap(!healthy); wasUnhealthy == healthy {
+		if healthy {
+			log.Infof("upstream is healthy: %s", self.URL)
+		} else {
+			log.Warningf("upstream is unhealthy: %s", self.URL)
+		}
+	}
+}
+
+//
+// proxyResponseWriter
+//
+
+// Writes into the [Context] so that the response can be cached.
+type proxyResponseWriter struct {
+	restContext *Context
+	cacheVary   []string
+	uncacheable bool
+}
+
+// ([http.ResponseWriter] interface)
+func (self *proxyResponseWriter) Header() http.Header {
+	return self.restContext.Response.Header
+}
+
+// ([http.ResponseWriter] interface)
+func (self *proxyResponseWriter) WriteHeader(status int) {
+	response := self.restContext.Response
+	response.Status = status
+
+	response.Header.Del("Content-Length")
+
+	if reason := self.uncacheableReason(); reason != "" {
+		self.restContext.Log.Debugf("not caching upstream response: %s", reason)
+		self.uncacheable = true
+	} else {
+		// We set our own
+		response.Header.Del(HeaderCacheControl)
+	}
+
+	if response.Header.Get(HeaderContentEncoding) != "" {
+		// The upstream encoded it anyway
+		self.restContext.Writer = response.Buffer
+	} else if status == http.StatusOK {
+		SetBestEncodeWriter(self.restContext)
+	}
+}
+
+// ([http.ResponseWriter] interface, [io.Writer] interface)
+func (self *proxyResponseWriter) Write(p []byte) (int, error) {
+	return self.restContext.Writer.Write(p)
+}
+
+// Returns an empty string if the response can be cached.
+func (self *proxyResponseWriter) uncacheableReason() string {
+	header := self.restContext.Response.Header
+
+	for _, value := range header.Values(HeaderCacheControl) {
+		for _, directive := range strings.Split(value, ",") {
+			directive = strings.ToLower(strings.TrimSpace(directive))
+			if index := strings.IndexByte(directive, '='); index != -1 {
+				// E.g. `private="Set-Cookie"`
+				directive = directive[:index]
+			}
+			switch directive {
+			case "private", "no-store", "no-cache":
+				return "Cache-Control: " + directive
+			}
+		}
+	}
+
+	if len(header.Values(HeaderSetCookie)) > 0 {
+		return "Set-Cookie"
+	}
+
+	// Our cache key must vary on everything that the upstream varies on
+	for _, value := range header.Values(HeaderVary) {
+		for _, name := range strings.Split(value, ",") {
+			name = strings.TrimSpace(name)
+			if name == "*" {
+				return "Vary: *"
+			} else if (name != "") && !strings.EqualFold(name, HeaderAcceptEncoding) && !containsHeaderName(self.cacheVary, name) {
+				// (We handle encoding ourselves)
+				return "Vary: " + name + " (add it to \"cacheVary\")"
+			}
+		}
+	}
+
+	return ""
+}
+
+func containsHeaderName(names []string, name string) bool {
+	for _, name_ := range names {
+		if strings.EqualFold(name_, name) {
+			return true
+		}
+	}
+	return false
+}
@@ -8,6 +8,7 @@ import (
 	"github.com/dop251/goja"
 	"github.com/tliron/commonjs-goja"
 	"github.com/tliron/go-ard"
+	"github.com/tliron/prudence/platform"
 )
 
 //
@@ -52,6 +53,7 @@ type Representation struct {
 	Erase                       RepresentationHook
 	Modify                      RepresentationHook
 	Call                        RepresentationHook
+	Compression                 *Compression // overrides the server's
 }
 
 func NewRepresentation(name string) *Representation {
@@ -85,6 +87,11 @@ func CreateRepresentation(jsContext *commonjs.Context, config ard.StringMap) (an
 		self.Variables = variables
 	}
 
+	var err error
+	if self.Compression, err = GetCompression(config_.Get("compression")); err != nil {
+		return nil, err
+	}
+
 	var hooks *ard.Node
 	hooksJsContext := jsContext
 	if hooks = config_.Get("hooks"); hooks.Value != nil {
@@ -108,7 +115,6 @@ func CreateRepresentation(jsContext *commonjs.Context, config ard.StringMap) (an
 		return nil, nil
 	}
 
-	var err error
 	if self.Prepare, err = getHook("prepare"); err != nil {
 		return nil, err
 	}
@@ -145,18 +151,16 @@ func (self *Representation) Handle(restContext *Context) (bool, error) {
 
 	restContext.Response.CharSet = self.CharSet
 
+	if self.Compression != nil {
+		restContext.Compression = self.Compression
+	}
+
 	switch restContext.Request.Method {
 	case "GET":
 		// https://developer.mozilla.org/en-US/docs/Web/HTTP/Methods/GET
 		if err := self.prepare(restContext); err == nil {
-			if !self.presentFromCache(restContext, true) {
-				if ok, err := self.negotiate(restContext); err == nil {
-					if ok {
-						if err := self.respond(restContext, true); err != nil {
-							return false, err
-						}
-					}
-				} else {
+			if presented, stale := self.presentFromCache(restContext, true); !presented {
+				if err := self.coalesce(restContext, true, stale); err != nil {
 					return false, err
 				}
 			}
@@ -171,14 +175,8 @@ func (self *Representation) Handle(restContext *Context) (bool, error) {
 		restContext.Writer = io.Discard
 
 		if err := self.prepare(restContext); err == nil {
-			if !self.presentFromCache(restContext, false) {
-				if ok, err := self.negotiate(restContext); err == nil {
-					if ok {
-						if err := self.respond(restContext, false); err != nil {
-							return false, err
-						}
-					}
-				} else {
+			if presented, stale := self.presentFromCache(restContext, false); !presented {
+				if err := self.coalesce(restContext, false, stale); err != nil {
 					return false, err
 				}
 			}
@@ -230,24 +228,98 @@ func (self *Representation) prepare(restContext *Context) error {
 	}
 }
 
-func (self *Representation) presentFromCache(restContext *Context, withBody bool) bool {
-	if restContext.CacheKey != "" {
+// Returns true if presented. Otherwise might return a stale cached
+// representation that can be used if we fail to generate a fresh one.
+func (self *Representation) presentFromCache(restContext *Context, withBody bool) (bool, *platform.CachedRepresentation) {
+	if (restContext.CacheKey != "") && !restContext.revalidating {
 		if key, cached, ok := restContext.LoadCachedRepresentation(); ok {
 			if withBody && (len(cached.Body) == 0) {
 				// The cache entry was likely created by a previous HEAD request
 				restContext.Log.Debugf("ignoring cached representation because it has no body: %s", restContext.Request.Path)
-			} else {
+			} else if !cached.Expired() || cached.CanRevalidate() {
+				if cached.Expired() {
+					self.revalidate(restContext, key)
+				}
 				if changed := restContext.PresentCachedRepresentation(cached, withBody); changed {
 					restContext.UpdateCachedRepresentation(key, cached)
 				}
-				return true
+				return true, nil
+			} else if cached.CanServeOnError() {
+				return false, cached
 			}
 		}
 	}
 
+	return false, nil
+}
+
+// Only one request at a time will render the representation for a cache key.
+// The others will present its result.
+func (self *Representation) coalesce(restContext *Context, withBody bool, stale *platform.CachedRepresentation) error {
+	render := func() error {
+		return self.render(restContext, withBody, stale)
+	}
+
+	if (restContext.CacheKey == "") || restContext.revalidating {
+		return render()
+	}
+
+	if cached, err := restContext.Coalesce(withBody, render); err == nil {
+		if cached != nil {
+			restContext.PresentCachedRepresentation(cached, withBody)
+		}
+		return nil
+	} else {
+		return err
+	}
+}
+
+func (self *Representation) render(restContext *Context, withBody bool, stale *platform.CachedRepresentation) error {
+	if ok, err := self.negotiate(restContext); err == nil {
+		if ok {
+			if err := self.respond(restContext, withBody); err != nil {
+				if !self.presentStale(restContext, stale, withBody, err) {
+					return err
+				}
+			}
+		}
+	} else if !self.presentStale(restContext, stale, withBody, err) {
+		return err
+	}
+
+	return nil
+}
+
+func (self *Representation) presentStale(restContext *Context, stale *platform.CachedRepresentation, withBody bool, err error) bool {
+	if stale != nil {
+		restContext.Log.Warningf("using stale cached representation because of error: %s", err.Error())
+		restContext.Response.Status = 0
+		restContext.PresentCachedRepresentation(stale, withBody)
+		return true
+	}
+
 	return false
 }
 
+// Generates a fresh representation in the background and stores it in the
+// cache. See [Context.revalidate].
+func (self *Representation) revalidate(restContext *Context, key platform.CacheKey) {
+	restContext.revalidate(key, func(restContext *Context) error {
+		if err := self.prepare(restContext); err != nil {
+			return err
+		}
+
+		if ok, err := self.negotiate(restContext); err == nil {
+			if ok {
+				return self.respond(restContext, true)
+			}
+			return nil
+		} else {
+			return err
+		}
+	})
+}
+
 func (self *Representation) negotiate(restContext *Context) (bool, error) {
 	if self.Describe != nil {
 		if err := self.Describe(restContext); err == nil {
@@ -274,7 +346,7 @@ func (self *Representation) respond(restContext *Context, withBody bool) error {
 			}
 		}
 
-		if restContext.isNotModified(false) {
+		if !restContext.Response.streaming && restContext.isNotModified(false) {
 			return nil
 		}
 	}
@@ -288,6 +360,8 @@ func (self *Representation) respond(restContext *Context, withBody bool) error {
 	restContext.Response.setETag()
 	restContext.Response.setLastModified()
 	restContext.setCacheControl()
+	restContext.setVary()
+	restContext.setSurrogateKeys()
 
 	if restContext.caching() {
 		restContext.StoreCachedRepresentation(withBody)
@@ -346,6 +420,8 @@ func (self *Representation) modify(restContext *Context) error {
 			}
 
 			if restContext.caching() {
+				restContext.setVary()
+				restContext.setSurrogateKeys()
 				restContext.StoreCachedRepresentation(true)
 			}
 		} else {
@@ -1,6 +1,7 @@
 package rest
 
 import (
+	"crypto/x509"
 	"io"
 	"net/http"
 	"net/url"
@@ -24,6 +25,11 @@ type Request struct {
 	Query   url.Values
 	Cookies []*http.Cookie
 
+	// Client certificate (mTLS)
+	Peer             string // subject common name
+	PeerVerified     bool
+	PeerCertificates []*x509.Certificate
+
 	Direct *http.Request
 }
 
@@ -46,6 +52,12 @@ func NewRequest(request *http.Request) *Request {
 		Direct:  request,
 	}
 
+	if (request.TLS != nil) && (len(request.TLS.PeerCertificates) > 0) {
+		self.PeerCertificates = request.TLS.PeerCertificates
+		self.Peer = self.PeerCertificates[0].Subject.CommonName
+		self.PeerVerified = len(request.TLS.VerifiedChains) > 0
+	}
+
 	return &self
 }
 
@@ -56,14 +68,17 @@ func (self *Request) Clone() *Request {
 	}
 
 	return &Request{
-		Host:    self.Host,
-		Port:    self.Port,
-		Path:    self.Path,
-		Header:  self.Header.Clone(),
-		Method:  self.Method,
-		Query:   CloneURLValues(self.Query),
-		Cookies: CloneCookies(self.Cookies),
-		Direct:  self.Direct,
+		Host:             self.Host,
+		Port:             self.Port,
+		Path:             self.Path,
+		Header:           self.Header.Clone(),
+		Method:           self.Method,
+		Query:            CloneURLValues(self.Query),
+		Cookies:          CloneCookies(self.Cookies),
+		Peer:             self.Peer,
+		PeerVerified:     self.PeerVerified,
+		PeerCertificates: self.PeerCertificates,
+		Direct:           self.Direct,
 	}
 }
 
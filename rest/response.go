@@ -29,6 +29,9 @@ type Response struct {
 	Buffer *bytes.Buffer
 	Bypass bool
 	Direct http.ResponseWriter
+
+	streaming bool          // status and headers have already been written
+	streamed  *bytes.Buffer // copy of the body written so far, if caching
 }
 
 func NewResponse(responseWriter http.ResponseWriter) *Response {
@@ -56,6 +59,8 @@ func (self *Response) Clone() *Response {
 		Buffer:        self.Buffer,
 		Bypass:        self.Bypass,
 		Direct:        self.Direct,
+		streaming:     self.streaming,
+		streamed:      self.streamed,
 	}
 }
 
@@ -78,6 +83,22 @@ func (self *Response) flush() error {
 		return nil
 	}
 
+	if !self.streaming {
+		self.writeHeader()
+	}
+
+	if self.Buffer.Len() == 0 {
+		/*if status == http.StatusOK {
+			status = http.StatusNoContent // 204
+		}*/
+		return nil
+	} else {
+		return self.writeBuffer()
+	}
+}
+
+// Writes the status and headers.
+func (self *Response) writeHeader() {
 	status := self.Status
 	if (status < 100) || (status > 999) {
 		// Otherwise will panic in net/http.checkWriteHeaderCode
@@ -100,17 +121,37 @@ func (self *Response) flush() error {
 		http.SetCookie(self.Direct, cookie)
 	}
 
-	if self.Buffer.Len() == 0 {
-		/*if status == http.StatusOK {
-			status = http.StatusNoContent // 204
-		}*/
-		self.Direct.WriteHeader(status)
-		return nil
-	} else {
-		self.Direct.WriteHeader(status)
-		_, err := self.Direct.Write(self.Buffer.Bytes())
-		return err
+	self.Direct.WriteHeader(status)
+}
+
+func (self *Response) writeBuffer() error {
+	if self.streaming {
+		// Only keep what was not yet written
+		defer self.Buffer.Reset()
+		if self.streamed != nil {
+			self.streamed.Write(self.Buffer.Bytes())
+		}
 	}
+
+	_, err := self.Direct.Write(self.Buffer.Bytes())
+	return err
+}
+
+// The whole body, also when streaming. Returns false if streaming without
+// keeping a copy of what was written.
+func (self *Response) body() ([]byte, bool) {
+	if self.streaming {
+		if self.streamed == nil {
+			return nil, false
+		}
+
+		body := make([]byte, 0, self.streamed.Len()+self.Buffer.Len())
+		body = append(body, self.streamed.Bytes()...)
+		body = append(body, self.Buffer.Bytes()...)
+		return body, true
+	}
+
+	return self.Buffer.Bytes(), true
 }
 
 func (self *Response) eTag(fromHeader bool) string {
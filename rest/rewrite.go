@@ -0,0 +1,514 @@
+package rest
+
+import (
+	contextpkg "context"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/tliron/commonjs-goja"
+	"github.com/tliron/go-ard"
+	"github.com/tliron/prudence/platform"
+)
+
+//
+// Rewrite
+//
+// Rules are tried in order and the first rule that matches is applied. Rules
+// with literal paths (no variables, wildcards, or regular expressions) are
+// looked up by path rather than tried one by one, but they still keep their
+// place in the order.
+//
+
+type Rewrite struct {
+	Rules      []*RewriteRule
+	Handler    HandleFunc // called after rewriting, if nil we will let the next route handle it
+	TrustProxy bool       // use "X-Forwarded-Proto" for the "schemes" condition
+
+	literals map[string][]*RewriteRule // by path
+	patterns []*RewriteRule
+}
+
+func NewRewrite() *Rewrite {
+	return &Rewrite{
+		literals: make(map[string][]*RewriteRule),
+	}
+}
+
+// ([platform.CreateFunc] signature)
+func CreateRewrite(jsContext *commonjs.Context, config ard.StringMap) (any, error) {
+	config_ := ard.With(config).ConvertSimilar().NilMeansZero()
+
+	self := NewRewrite()
+
+	for _, rule := range platform.AsConfigList(config_.Get("rules").Value) {
+		if rule_, ok := rule.(ard.StringMap); ok {
+			if err := self.addRuleFromConfig(rule_); err != nil {
+				return nil, err
+			}
+		} else {
+			return nil, fmt.Errorf("rewrite rule is not a map: %T", rule)
+		}
+	}
+
+	for _, file := range platform.AsStringList(config_.Get("files")) {
+		if err := self.load(jsContext, file); err != nil {
+			return nil, err
+		}
+	}
+
+	if handler := config_.Get("handler").Value; handler != nil {
+		var err error
+		if self.Handler, err = GetHandleFunc(handler, jsContext); err != nil {
+			return nil, err
+		}
+	}
+
+	self.TrustProxy, _ = config_.Get("trustProxy").Boolean()
+
+	return self, nil
+}
+
+func (self *Rewrite) AddRule(rule *RewriteRule) {
+	rule.index = len(self.Rules)
+	self.Rules = append(self.Rules, rule)
+	if rule.literal {
+		self.literals[rule.Path] = append(self.literals[rule.Path], rule)
+	} else {
+		self.patterns = append(self.patterns, rule)
+	}
+}
+
+// ([Handler] interface, [HandleFunc] signature)
+func (self *Rewrite) Handle(restContext *Context) (bool, error) {
+	if rule, variables := self.match(restContext); rule != nil {
+		if rule.Redirect != 0 {
+			target := rule.expand(variables)
+			if rule.KeepQuery && (restContext.Request.Direct.URL.RawQuery != "") && !strings.Contains(target, "?") {
+				target += "?" + restContext.Request.Direct.URL.RawQuery
+			}
+			return true, restContext.Redirect(target, rule.Redirect)
+		}
+
+		path, query, err := rule.expandInternal(variables)
+		if err != nil {
+			return true, err
+		}
+
+		restContext.Log.Debugf("rewrite: %s -> %s", restContext.Request.Path, path)
+		for name, value := range variables {
+			if _, err := strconv.Atoi(name); err != nil {
+				restContext.Variables[name] = value
+			}
+		}
+		restContext.Request.Path = strings.TrimPrefix(path, "/")
+		for name, values := range query {
+			restContext.Request.Query[name] = values
+		}
+	}
+
+	if self.Handler != nil {
+		return self.Handler(restContext)
+	}
+
+	return false, nil
+}
+
+func (self *Rewrite) match(restContext *Context) (*RewriteRule, map[string]any) {
+	var literal *RewriteRule
+	var literalVariables map[string]any
+	for _, rule := range self.literals[restContext.Request.Path] {
+		if hostVariables := rule.matchConditions(restContext, self.TrustProxy); hostVariables != nil {
+			literal = rule
+			literalVariables = make(map[string]any)
+			for name, value := range hostVariables {
+				literalVariables[name] = value
+			}
+			break
+		}
+	}
+
+	for _, rule := range self.patterns {
+		if (literal != nil) && (rule.index > literal.index) {
+			// The literal rule comes first
+			break
+		}
+
+		if variables := rule.matchPath(restContext.Request.Path); variables != nil {
+			if hostVariables := rule.matchConditions(restContext, self.TrustProxy); hostVariables != nil {
+				for name, value := range hostVariables {
+					variables[name] = value
+				}
+				return rule, variables
+			}
+		}
+	}
+
+	return literal, literalVariables
+}
+
+func (self *Rewrite) addRuleFromConfig(config ard.StringMap) error {
+	if rule, err := CreateRewriteRule(config); err == nil {
+		self.AddRule(rule)
+		return nil
+	} else {
+		return err
+	}
+}
+
+// CSV files must have a header row naming the columns, which are the same as
+// the rule keys. Lists (e.g. "hosts") are separated by whitespace. Other
+// formats (YAML, JSON) must contain a list of rules.
+func (self *Rewrite) load(jsContext *commonjs.Context, file string) error {
+	url, err := jsContext.Resolve(contextpkg.TODO(), file, true)
+	if err != nil {
+		return err
+	}
+
+	reader, err := url.Open(contextpkg.TODO())
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+
+	count := len(self.Rules)
+
+	if strings.HasSuffix(strings.ToLower(url.String()), ".csv") {
+		if err := self.loadCsv(reader); err != nil {
+			return fmt.Errorf("%s: %w", url.String(), err)
+		}
+	} else {
+		format := url.Format()
+		if format == "" {
+			format = "yaml"
+		}
+
+		if rules, _, err := ard.Read(reader, format, false); err == nil {
+			rules, _ = ard.ConvertMapsToStringMaps(rules)
+			if rules_, ok := rules.(ard.List); ok {
+				for _, rule := range rules_ {
+					if rule_, ok := rule.(ard.StringMap); ok {
+						if err := self.addRuleFromConfig(rule_); err != nil {
+							return fmt.Errorf("%s: %w", url.String(), err)
+						}
+					} else {
+						return fmt.Errorf("%s: rule is not a map: %T", url.String(), rule)
+					}
+				}
+			} else {
+				return fmt.Errorf("%s: not a list of rules: %T", url.String(), rules)
+			}
+		} else {
+			return err
+		}
+	}
+
+	log.Infof("loaded %d rewrite rules from: %s", len(self.Rules)-count, url.String())
+	return nil
+}
+
+func (self *Rewrite) loadCsv(reader io.Reader) error {
+	csvReader := csv.NewReader(reader)
+	csvReader.TrimLeadingSpace = true
+	csvReader.Comment = '#'
+	csvReader.FieldsPerRecord = -1
+
+	header, err := csvReader.Read()
+	if err != nil {
+		return err
+	}
+
+	for {
+		record, err := csvReader.Read()
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				return nil
+			}
+			return err
+		}
+
+		config := make(ard.StringMap)
+		for index, value := range record {
+			if (index < len(header)) && (value != "") {
+				switch name := strings.TrimSpace(header[index]); name {
+				case "hosts", "schemes":
+					config[name] = strings.Fields(value)
+				case "status":
+					if status, err := strconv.Atoi(value); err == nil {
+						config[name] = status
+					} else {
+						line, _ := csvReader.FieldPos(index)
+						return fmt.Errorf("line %d: status is not a number: %s", line, value)
+					}
+				default:
+					config[name] = value
+				}
+			}
+		}
+
+		if err := self.addRuleFromConfig(config); err != nil {
+			return err
+		}
+	}
+}
+
+//
+// RewriteRule
+//
+
+type RewriteRule struct {
+	Path         string         // literal path or path template
+	PathTemplate *PathTemplate  // nil if Path is literal or if using Regex
+	Regex        *regexp.Regexp // must match the whole path, named groups become variables, numbered groups too
+	To           string         // can contain "{variable}" and "{1}"
+	Redirect     int            // status, 0 to rewrite internally
+	KeepQuery    bool           // when redirecting, if "To" does not have a query
+
+	Hosts   HostTemplates // e.g. "*.example.com", "{tenant}.example.com"
+	Schemes []string      // "http" or "https"
+	Query   ValueConditions
+	Headers ValueConditions
+
+	literal bool
+	index   int
+}
+
+func CreateRewriteRule(config ard.StringMap) (*RewriteRule, error) {
+	config_ := ard.With(config).ConvertSimilar().NilMeansZero()
+
+	self := RewriteRule{
+		KeepQuery: true,
+	}
+
+	var ok bool
+	if self.To, ok = config_.Get("to").String(); !ok {
+		return nil, errors.New("rewrite rule must have \"to\"")
+	}
+
+	if regex, ok := config_.Get("regex").String(); ok {
+		var err error
+		// Like path templates, must match the whole path
+		if self.Regex, err = regexp.Compile("^(?:" + regex + ")$"); err != nil {
+			return nil, err
+		}
+	} else if path, ok := config_.Get("path").String(); ok {
+		self.Path = strings.TrimPrefix(path, "/")
+		if strings.ContainsAny(self.Path, "{*[\\") {
+			var err error
+			if self.PathTemplate, err = NewPathTemplate(self.Path); err != nil {
+				return nil, err
+			}
+		} else {
+			self.literal = true
+		}
+	} else {
+		return nil, errors.New("rewrite rule must have \"path\" or \"regex\"")
+	}
+
+	if status, ok := config_.Get("status").Integer(); ok {
+		self.Redirect = int(status)
+	} else if redirect, ok := config_.Get("redirect").Boolean(); ok && redirect {
+		self.Redirect = http.StatusMovedPermanently // 301
+	}
+	if (self.Redirect != 0) && ((self.Redirect < 300) || (self.Redirect >= 400)) {
+		return nil, fmt.Errorf("rewrite rule status is not a redirect: %d", self.Redirect)
+	}
+
+	if keepQuery, ok := config_.Get("keepQuery").Boolean(); ok {
+		self.KeepQuery = keepQuery
+	}
+
+	var err error
+	if hosts := platform.AsStringList(config_.Get("hosts")); len(hosts) > 0 {
+		if self.Hosts, err = NewHostTemplates(hosts...); err != nil {
+			return nil, err
+		}
+	}
+
+	self.Schemes = platform.AsStringList(config_.Get("schemes"))
+
+	if self.Query, err = getValueConditions(config_.Get("query")); err != nil {
+		return nil, err
+	}
+	if self.Headers, err = getValueConditions(config_.Get("headers")); err != nil {
+		return nil, err
+	}
+
+	return &self, nil
+}
+
+// Returns nil if it doesn't match.
+func (self *RewriteRule) matchPath(path string) map[string]any {
+	if self.PathTemplate != nil {
+		// Typed variables are converted and absent optional parts are omitted
+		variables := self.PathTemplate.Match(path)
+		if wildcard, ok := variables[PathVariable]; ok {
+			delete(variables, PathVariable)
+			variables["*"] = wildcard
+		}
+		return variables
+	}
+
+	matches := self.Regex.FindStringSubmatch(path)
+	if matches == nil {
+		return nil
+	}
+
+	variables := make(map[string]any)
+	for index, name := range self.Regex.SubexpNames() {
+		if index > 0 {
+			variables[strconv.Itoa(index)] = matches[index]
+			if name != "" {
+				variables[name] = matches[index]
+			}
+		}
+	}
+	return variables
+}
+
+// Returns the host variables, or nil if the conditions are not met.
+func (self *RewriteRule) matchConditions(restContext *Context, trustProxy bool) map[string]string {
+	variables := self.Hosts.MatchAny(restContext.Request.Host)
+	if variables == nil {
+		return nil
+	}
+
+	if len(self.Schemes) > 0 {
+		scheme := getScheme(restContext.Request, trustProxy)
+		matched := false
+		for _, scheme_ := range self.Schemes {
+			if scheme_ == scheme {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			return nil
+		}
+	}
+
+	if !self.Query.MatchQuery(restContext.Request.Query) || !self.Headers.MatchHeader(restContext.Request.Header) {
+		return nil
+	}
+
+	return variables
+}
+
+// Placeholders are substituted in a single pass, so values are never themselves
+// expanded. Variables in absent optional parts become empty and unknown
+// placeholders are kept as is.
+//
+// Values come from the request, so they must not turn a relative target into
+// an absolute one, e.g. "/{*}" into "//evil.com", which would be an open
+// redirect.
+func (self *RewriteRule) expand(variables map[string]any) string {
+	target := self.substitute(self.To, variables, nil)
+
+	if !isAbsoluteURL(self.To) {
+		target = collapseLeadingSlashes(target)
+	}
+
+	return target
+}
+
+// For internal rewrites. The path and query parts of "To" are expanded
+// separately, so that values can neither add a query nor be mistaken for
+// escapes. Values in the query are escaped.
+func (self *RewriteRule) expandInternal(variables map[string]any) (string, url.Values, error) {
+	toPath, toQuery, hasQuery := strings.Cut(self.To, "?")
+
+	path := collapseLeadingSlashes(self.substitute(toPath, variables, nil))
+
+	var query url.Values
+	if hasQuery {
+		var err error
+		if query, err = url.ParseQuery(self.substitute(toQuery, variables, url.QueryEscape)); err != nil {
+			return "", nil, err
+		}
+	}
+
+	return path, query, nil
+}
+
+func (self *RewriteRule) substitute(template string, variables map[string]any, escape func(string) string) string {
+	var builder strings.Builder
+	to := template
+	for {
+		start := strings.IndexRune(to, '{')
+		if start == -1 {
+			break
+		}
+		end := strings.IndexRune(to[start:], '}')
+		if end == -1 {
+			break
+		}
+		end += start
+
+		builder.WriteString(to[:start])
+		name := to[start+1 : end]
+		if value, ok := variables[name]; ok {
+			value := fmt.Sprintf("%v", value)
+			if escape != nil {
+				value = escape(value)
+			}
+			builder.WriteString(value)
+		} else if !self.hasPathVariable(name) {
+			// Unknown
+			builder.WriteString(to[start : end+1])
+		}
+
+		to = to[end+1:]
+	}
+	builder.WriteString(to)
+	return builder.String()
+}
+
+// The target is relative, so it must not become absolute.
+func collapseLeadingSlashes(target string) string {
+	if isAbsoluteURL(target) {
+		target = "/" + target
+	}
+	if strings.HasPrefix(target, "/") || strings.HasPrefix(target, "\\") {
+		// Collapse leading slashes (browsers treat "\" like "/")
+		target = "/" + strings.TrimLeft(target, "/\\")
+	}
+	return target
+}
+
+func (self *RewriteRule) hasPathVariable(name string) bool {
+	regex := self.Regex
+	if self.PathTemplate != nil {
+		regex = self.PathTemplate.RegularExpression
+		if name == "*" {
+			name = PathVariable
+		}
+	}
+	return (regex != nil) && (regex.SubexpIndex(name) != -1)
+}
+
+var schemeRegexp = regexp.MustCompile(`^[a-zA-Z][a-zA-Z0-9+.\-]*:`)
+
+// Has a scheme or is protocol-relative.
+func isAbsoluteURL(url string) bool {
+	return strings.HasPrefix(url, "//") || strings.HasPrefix(url, "/\\") || strings.HasPrefix(url, "\\") || schemeRegexp.MatchString(url)
+}
+
+// Only trust "X-Forwarded-Proto" if there is a reverse proxy in front of us
+// that sets it, otherwise any client could set it.
+func getScheme(request *Request, trustProxy bool) string {
+	if trustProxy {
+		if proto := request.Header.Get("X-Forwarded-Proto"); proto != "" {
+			return strings.ToLower(strings.TrimSpace(strings.Split(proto, ",")[0]))
+		}
+	}
+	if request.Direct.TLS != nil {
+		return "https"
+	}
+	return "http"
+}
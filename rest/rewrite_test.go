@@ -0,0 +1,56 @@
+package rest
+
+import (
+	"net/url"
+	"reflect"
+	"testing"
+
+	"github.com/tliron/go-ard"
+)
+
+func TestRewriteRuleExpandInternal(t *testing.T) {
+	tests := []struct {
+		path         string
+		to           string
+		requestPath  string
+		expectedPath string
+		expected     url.Values
+	}{
+		{"old", "/new?x=1", "old", "/new", url.Values{"x": {"1"}}},
+		{"old", "new", "old", "new", nil},
+		{"users/{name}", "/profile?user={name}&tab=posts", "users/a&b=c", "/profile", url.Values{"user": {"a&b=c"}, "tab": {"posts"}}},
+
+		// Values can't add a query or become absolute
+		{"files/{path*}", "/static/{path}", "files/a?b=c", "/static/a?b=c", nil},
+		{"r/{path*}", "{path}", "r/http://evil.com", "/http://evil.com", nil},
+		{"r/{path*}", "/{path}", "r//evil.com", "/evil.com", nil},
+	}
+
+	for _, test := range tests {
+		rule, err := CreateRewriteRule(ard.StringMap{"path": test.path, "to": test.to})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		variables := map[string]any{}
+		if !rule.literal {
+			variables = rule.matchPath(test.requestPath)
+		}
+		if variables == nil {
+			t.Errorf("%q did not match %q", test.path, test.requestPath)
+			continue
+		}
+
+		path, query, err := rule.expandInternal(variables)
+		if err != nil {
+			t.Errorf("%q: %s", test.to, err)
+			continue
+		}
+		if path != test.expectedPath {
+			t.Errorf("%q: expected path %q, got %q", test.to, test.expectedPath, path)
+		}
+		if !reflect.DeepEqual(query, test.expected) {
+			t.Errorf("%q: expected query %v, got %v", test.to, test.expected, query)
+		}
+	}
+}
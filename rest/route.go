@@ -2,6 +2,7 @@ package rest
 
 import (
 	"net/http"
+	"strings"
 
 	"github.com/tliron/commonjs-goja"
 	"github.com/tliron/go-ard"
@@ -12,12 +13,21 @@ import (
 // Route
 //
 // Wraps a handler so that it would only be called if any
-// single path template matches (in sequence)
+// single path template matches (in sequence) and any single
+// host template matches (in sequence)
+//
+// Additional optional constraints can be set on the request
+// method, headers, query, and content type. All must match.
 //
 
 type Route struct {
 	Name                        string
+	HostTemplates               HostTemplates
 	PathTemplates               PathTemplates
+	Methods                     []string // "HEAD" is implied by "GET"
+	Headers                     ValueConditions
+	Query                       ValueConditions
+	ContentTypes                []string // supports "type/*"
 	RedirectTrailingSlashStatus int
 	Variables                   map[string]any
 	Handler                     HandleFunc
@@ -40,12 +50,32 @@ func CreateRoute(jsContext *commonjs.Context, config ard.StringMap) (any, error)
 	self := NewRoute(name)
 
 	var err error
+	if hosts := platform.AsStringList(config_.Get("hosts")); len(hosts) > 0 {
+		if self.HostTemplates, err = NewHostTemplates(hosts...); err != nil {
+			return nil, err
+		}
+	}
+
 	if paths := platform.AsStringList(config_.Get("paths")); len(paths) > 0 {
 		if self.PathTemplates, err = NewPathTemplates(paths...); err != nil {
 			return nil, err
 		}
 	}
 
+	for _, method := range platform.AsStringList(config_.Get("methods")) {
+		self.Methods = append(self.Methods, strings.ToUpper(method))
+	}
+
+	if self.Headers, err = getValueConditions(config_.Get("headers")); err != nil {
+		return nil, err
+	}
+
+	if self.Query, err = getValueConditions(config_.Get("query")); err != nil {
+		return nil, err
+	}
+
+	self.ContentTypes = platform.AsStringList(config_.Get("contentTypes"))
+
 	if redirectTrailingSlashStatus, ok := config_.Get("redirectTrailingSlashStatus").UnsignedInteger(); ok {
 		self.RedirectTrailingSlashStatus = int(redirectTrailingSlashStatus)
 	}
@@ -65,16 +95,25 @@ func CreateRoute(jsContext *commonjs.Context, config ard.StringMap) (any, error)
 
 // ([Handler] interface, [HandleFunc] signature)
 func (self *Route) Handle(restContext *Context) (bool, error) {
+	hostMatches := self.MatchHost(restContext.Request.Host)
+	if (hostMatches == nil) || !self.MatchConstraints(restContext.Request) {
+		return false, nil
+	}
+
 	if matches := self.Match(restContext.Request.Path); matches != nil {
 		restContext = restContext.AppendName(self.Name, true)
 
 		ard.Merge(restContext.Variables, self.Variables, false)
 
+		for key, value := range hostMatches {
+			restContext.Variables[key] = value
+		}
+
 		for key, value := range matches {
 			switch key {
 			case PathVariable:
 				// Special handling for "*"
-				restContext.Request.Path = value
+				restContext.Request.Path = value.(string)
 
 			default:
 				restContext.Variables[key] = value
@@ -91,11 +130,43 @@ func (self *Route) Handle(restContext *Context) (bool, error) {
 	return false, nil
 }
 
-func (self *Route) Match(path string) map[string]string {
+func (self *Route) Match(path string) map[string]any {
 	if len(self.PathTemplates) == 0 {
 		// Empty paths always matches
-		return make(map[string]string)
+		return make(map[string]any)
 	}
 
 	return self.PathTemplates.MatchAny(path)
 }
+
+func (self *Route) MatchHost(host string) map[string]string {
+	// Empty hosts always matches
+	return self.HostTemplates.MatchAny(host)
+}
+
+func (self *Route) MatchConstraints(request *Request) bool {
+	if len(self.Methods) > 0 {
+		matched := false
+		for _, method := range self.Methods {
+			if (method == request.Method) || ((method == http.MethodGet) && (request.Method == http.MethodHead)) {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			return false
+		}
+	}
+
+	if !self.Headers.MatchHeader(request.Header) || !self.Query.MatchQuery(request.Query) {
+		return false
+	}
+
+	if len(self.ContentTypes) > 0 {
+		if contentType := request.Header.Get(HeaderContentType); (contentType == "") || !matchContentTypes(contentType, self.ContentTypes) {
+			return false
+		}
+	}
+
+	return true
+}
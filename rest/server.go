@@ -3,8 +3,10 @@ package rest
 import (
 	contextpkg "context"
 	"crypto/tls"
+	"errors"
 	"fmt"
 	"io"
+	"io/fs"
 	"net"
 	"net/http"
 	"os"
@@ -13,11 +15,13 @@ import (
 	"sync"
 	"time"
 
+	"github.com/quic-go/quic-go/http3"
 	"github.com/tliron/commonjs-goja"
 	"github.com/tliron/commonlog"
 	"github.com/tliron/go-ard"
 	"github.com/tliron/kutil/util"
 	"github.com/tliron/prudence/platform"
+	"github.com/valyala/fasthttp"
 	"gocloud.dev/server/requestlog"
 )
 
@@ -35,27 +39,43 @@ const (
 //
 
 type Server struct {
-	Name                string
-	Protocol            string
-	Address             string
-	Port                uint64
-	TLS                 bool
-	Certificate         string
-	Key                 string
-	GenerateCertificate bool
-	NCSALogFileSuffix   string
-	Debug               bool
-	HandlerTimeout      time.Duration
-	ReadHeaderTimeout   time.Duration
-	ReadTimeout         time.Duration
-	WriteTimeout        time.Duration
-	IdleTimeout         time.Duration
-	Handler             HandleFunc
-
-	server     *http.Server
-	serverLock sync.Mutex
-	started    sync.WaitGroup
-	log        commonlog.Logger
+	Name                 string
+	Engine               string
+	Protocol             string
+	Address              string
+	Port                 uint64
+	Socket               string // Unix domain socket path
+	SocketMode           fs.FileMode
+	SocketActivation     bool
+	SocketActivationName string
+	TLS                  bool
+	Certificate          string
+	Key                  string
+	GenerateCertificate  bool
+	ACME                 *ACME
+	CertificateFiles     []CertificateFiles
+	WatchCertificates    bool
+	ClientCA             string
+	ClientAuth           tls.ClientAuthType
+	HTTP3                bool
+	NCSALogFileSuffix    string
+	Debug                bool
+	SurrogateKeyHeaders  []string // response headers for cache groups, e.g. "Surrogate-Key"
+	Compression          *Compression
+	HandlerTimeout       time.Duration
+	ReadHeaderTimeout    time.Duration
+	ReadTimeout          time.Duration
+	WriteTimeout         time.Duration
+	IdleTimeout          time.Duration
+	Handler              HandleFunc
+
+	server           *http.Server
+	serverLock       sync.Mutex
+	certificateStore *CertificateStore
+	http3Server      *http3.Server
+	fastServer       *fasthttp.Server
+	started          sync.WaitGroup
+	log              commonlog.Logger
 }
 
 func NewServer(name string) *Server {
@@ -65,7 +85,9 @@ func NewServer(name string) *Server {
 
 	return &Server{
 		Name:              name,
+		Engine:            EngineNetHTTP,
 		Port:              8080,
+		SocketMode:        DEFAULT_SOCKET_MODE,
 		log:               log,
 		HandlerTimeout:    DEFAULT_HANDLER_TIMEOUT,
 		ReadHeaderTimeout: DEFAULT_READ_HEADER_TIMEOUT,
@@ -84,7 +106,15 @@ func CreateServer(jsContext *commonjs.Context, config ard.StringMap) (any, error
 	self := NewServer(name)
 
 	address, _ := config_.Get("address").String()
-	if address, addressZone, err := util.ToReachableIPAddress(address); err == nil {
+	if strings.HasPrefix(address, UnixSocketPrefix) {
+		self.Socket = address[len(UnixSocketPrefix):]
+		if self.Socket == "" {
+			return nil, errors.New("Server \"address\" has an empty Unix socket path")
+		}
+	} else if strings.HasPrefix(address, SocketActivationPrefix) {
+		self.SocketActivation = true
+		self.SocketActivationName = address[len(SocketActivationPrefix):]
+	} else if address, addressZone, err := util.ToReachableIPAddress(address); err == nil {
 		if addressZone != "" {
 			address += "%" + addressZone
 		}
@@ -94,6 +124,13 @@ func CreateServer(jsContext *commonjs.Context, config ard.StringMap) (any, error
 		return nil, err
 	}
 
+	if socketMode := config_.Get("socketMode").Value; socketMode != nil {
+		var err error
+		if self.SocketMode, err = ParseSocketMode(socketMode); err != nil {
+			return nil, err
+		}
+	}
+
 	if port, ok := config_.Get("port").UnsignedInteger(); ok {
 		self.Port = port
 	}
@@ -114,13 +151,80 @@ func CreateServer(jsContext *commonjs.Context, config ard.StringMap) (any, error
 	self.Certificate, _ = tls.Get("certificate").String()
 	self.Key, _ = tls.Get("key").String()
 	self.GenerateCertificate, _ = tls.Get("generate").Boolean()
-	if self.GenerateCertificate || (self.Certificate != "") || (self.Key != "") {
+	if acme := tls.Get("acme"); acme.Value != nil {
+		var err error
+		if self.ACME, err = CreateACME(acme); err != nil {
+			return nil, err
+		}
+	}
+	for _, files := range platform.AsConfigList(tls.Get("files").Value) {
+		files_ := ard.With(files).ConvertSimilar().NilMeansZero()
+		var certificateFiles CertificateFiles
+		var ok bool
+		if certificateFiles.Certificate, ok = files_.Get("certificate").String(); !ok {
+			return nil, errors.New("Server \"tls.files\" must have \"certificate\"")
+		}
+		if certificateFiles.Key, ok = files_.Get("key").String(); !ok {
+			return nil, errors.New("Server \"tls.files\" must have \"key\"")
+		}
+		self.CertificateFiles = append(self.CertificateFiles, certificateFiles)
+	}
+	if self.GenerateCertificate || (self.Certificate != "") || (self.Key != "") || (self.ACME != nil) || (len(self.CertificateFiles) > 0) {
 		self.TLS = true
 	}
+	if watch, ok := tls.Get("watch").Boolean(); ok {
+		self.WatchCertificates = watch
+	} else {
+		self.WatchCertificates = true
+	}
+	self.ClientCA, _ = tls.Get("clientCA").String()
+	if clientAuth, ok := tls.Get("clientAuth").String(); ok {
+		var err error
+		if self.ClientAuth, err = ParseClientAuth(clientAuth); err != nil {
+			return nil, err
+		}
+	} else if self.ClientCA != "" {
+		self.ClientAuth, _ = ParseClientAuth("requireAndVerify")
+	}
+
+	self.HTTP3, _ = config_.Get("http3").Boolean()
+	if self.HTTP3 && !self.TLS {
+		return nil, errors.New("Server \"http3\" requires \"tls\"")
+	}
+	if engine, ok := config_.Get("engine").String(); ok {
+		switch engine {
+		case EngineNetHTTP, EngineFastHTTP:
+			self.Engine = engine
+
+		default:
+			return nil, fmt.Errorf("\"engine\" must be \"nethttp\" or \"fasthttp\": %s", engine)
+		}
+	}
+	if self.HTTP3 && (self.Engine == EngineFastHTTP) {
+		return nil, errors.New("Server \"http3\" is not supported by the \"fasthttp\" engine")
+	}
+	if self.HTTP3 && ((self.Socket != "") || self.SocketActivation) {
+		return nil, errors.New("Server \"http3\" requires an IP \"address\"")
+	}
 
 	self.NCSALogFileSuffix, _ = config_.Get("ncsaLogFileSuffix").String()
 	self.Debug, _ = config_.Get("debug").Boolean()
 
+	var err error
+	if self.Compression, err = GetCompression(config_.Get("compression")); err != nil {
+		return nil, err
+	}
+
+	if surrogateKeys := config_.Get("surrogateKeys"); surrogateKeys.Value != nil {
+		if surrogateKeys_, ok := surrogateKeys.Boolean(); ok {
+			if surrogateKeys_ {
+				self.SurrogateKeyHeaders = []string{HeaderSurrogateKey}
+			}
+		} else {
+			self.SurrogateKeyHeaders = platform.AsStringList(surrogateKeys)
+		}
+	}
+
 	if timeout, ok := config_.Get("handlerTimeout").Float(); ok {
 		self.HandlerTimeout = time.Duration(timeout * float64(time.Second))
 	}
@@ -156,10 +260,14 @@ func (self *Server) Start() error {
 	self.log = commonlog.NewKeyValueLogger(log,
 		"_scope", "server",
 		"name", self.Name,
+		"engine", self.Engine,
 		"address", self.Address,
 		"port", self.Port,
+		"socket", self.Socket,
+		"activation", self.SocketActivation,
 		"protocol", self.Protocol,
 		"secure", self.TLS,
+		"http3", self.HTTP3,
 	)
 
 	self.started.Add(1)
@@ -167,16 +275,41 @@ func (self *Server) Start() error {
 
 	self.log.Info("starting")
 
-	if listener, err := self.newListener(); err == nil {
+	if listener, tlsConfig, err := self.newListener(); err == nil {
 		defer listener.Close()
 
+		if self.Engine == EngineFastHTTP {
+			server := self.newFastServer(tlsConfig)
+
+			self.serverLock.Lock()
+			self.fastServer = server
+			self.serverLock.Unlock()
+
+			if self.ACME != nil {
+				self.ACME.StartChallengeServer(self.log)
+			}
+
+			return server.Serve(listener)
+		}
+
 		var handler http.Handler = self
 
 		if logger := self.newNcsaLogger(); logger != nil {
-			handler = requestlog.NewHandler(logger, handler)
+			handler = newNcsaHandler(logger, handler)
+		}
+
+		if self.HandlerTimeout > 0 {
+			handler = newTimeoutHandler(handler, self.HandlerTimeout)
 		}
 
-		handler = http.TimeoutHandler(handler, self.HandlerTimeout, "")
+		if self.HTTP3 {
+			if http3Server, err := self.startHttp3(handler, tlsConfig); err == nil {
+				// Advertise HTTP/3 to clients connecting via TCP
+				handler = newAltSvcHandler(http3Server, handler)
+			} else {
+				return err
+			}
+		}
 
 		server := &http.Server{
 			Addr:              self.Address,
@@ -197,6 +330,10 @@ func (self *Server) Start() error {
 		self.server = server
 		self.serverLock.Unlock()
 
+		if self.ACME != nil {
+			self.ACME.StartChallengeServer(self.log)
+		}
+
 		if err := server.Serve(listener); (err == nil) || (err == http.ErrServerClosed) {
 			return nil
 		} else {
@@ -212,11 +349,32 @@ func (self *Server) Stop(stopContext contextpkg.Context) error {
 	self.serverLock.Lock()
 	defer self.serverLock.Unlock()
 
-	if self.server != nil {
+	if (self.server != nil) || (self.fastServer != nil) {
 		self.log.Info("stopping")
-		err := self.server.Shutdown(stopContext)
+		if self.ACME != nil {
+			if err := self.ACME.StopChallengeServer(stopContext); err != nil {
+				self.log.Error(err.Error())
+			}
+		}
+		if self.certificateStore != nil {
+			self.certificateStore.StopWatching()
+			self.certificateStore = nil
+		}
+		if self.http3Server != nil {
+			if err := self.http3Server.Close(); err != nil {
+				self.log.Error(err.Error())
+			}
+			self.http3Server = nil
+		}
+		var err error
+		if self.server != nil {
+			err = self.server.Shutdown(stopContext)
+		} else {
+			err = self.fastServer.ShutdownWithContext(stopContext)
+		}
 		self.started.Wait()
 		self.server = nil
+		self.fastServer = nil
 		self.log.Info("stopped")
 		return err
 	} else {
@@ -246,6 +404,9 @@ func (self *Server) ServeHTTP(responseWriter http.ResponseWriter, request *http.
 	}()
 
 	restContext.Debug = self.Debug
+	restContext.SurrogateKeyHeaders = self.SurrogateKeyHeaders
+	restContext.Compression = self.Compression
+	restContext.Timeout = self.HandlerTimeout
 
 	if self.Name != "" {
 		restContext.Response.StaticHeader.Set(HeaderServer, self.Name)
@@ -269,28 +430,42 @@ func (self *Server) AddressPort() string {
 	return util.JoinIPAddressPort(self.Address, int(self.Port))
 }
 
-func (self *Server) newListener() (net.Listener, error) {
-	protocol := "tcp"
-	switch strings.ToLower(self.Protocol) {
-	case "ipv6":
-		protocol = "tcp6"
-
-	case "ipv4":
-		protocol = "tcp4"
-	}
-
+func (self *Server) newListener() (net.Listener, *tls.Config, error) {
 	if tlsConfig, err := self.newTlsConfig(); err == nil {
-		if listener, err := net.Listen(protocol, self.AddressPort()); err == nil {
+		var listener net.Listener
+		if self.SocketActivation {
+			listener, err = NewActivatedListener(self.SocketActivationName)
+		} else if self.Socket != "" {
+			listener, err = self.newUnixListener()
+		} else {
+			listener, err = net.Listen(self.network("tcp"), self.AddressPort())
+		}
+
+		if err == nil {
 			if tlsConfig != nil {
-				return tls.NewListener(listener, tlsConfig), nil
+				return tls.NewListener(listener, tlsConfig), tlsConfig, nil
 			} else {
-				return listener, nil
+				return listener, nil, nil
 			}
 		} else {
-			return nil, err
+			return nil, nil, err
 		}
 	} else {
-		return nil, err
+		return nil, nil, err
+	}
+}
+
+// Network is "tcp" or "udp"
+func (self *Server) network(network string) string {
+	switch strings.ToLower(self.Protocol) {
+	case "ipv6":
+		return network + "6"
+
+	case "ipv4":
+		return network + "4"
+
+	default:
+		return network
 	}
 }
 
@@ -302,9 +477,27 @@ func (self *Server) newTlsConfig() (*tls.Config, error) {
 	log := commonlog.NewKeyValueLogger(self.log, "_scope", "tls")
 
 	var tlsConfig *tls.Config
+	var store *CertificateStore
 	var err error
 
-	if self.GenerateCertificate {
+	if self.ACME != nil {
+		log.Infof("using ACME certificates from: %s", self.ACME.DirectoryURL)
+		tlsConfig = self.ACME.NewTLSConfig()
+	} else if len(self.CertificateFiles) > 0 {
+		log.Infof("using %d provided certificate files", len(self.CertificateFiles))
+		store = NewCertificateStore(log)
+		store.Files = self.CertificateFiles
+		if (self.Certificate != "") || (self.Key != "") {
+			if tlsConfig, err = util.CreateTLSConfig(util.StringToBytes(self.Certificate), (util.StringToBytes(self.Key))); err == nil {
+				store.Static = tlsConfig.Certificates
+			} else {
+				return nil, err
+			}
+		}
+		tlsConfig = &tls.Config{
+			GetCertificate: store.GetCertificate,
+		}
+	} else if self.GenerateCertificate {
 		log.Info("generating certificate and key")
 		if tlsConfig, err = util.CreateSelfSignedTLSConfig("Prudence", self.Address, 0, 0); err == nil {
 			if len(tlsConfig.Certificates) == 0 {
@@ -348,7 +541,39 @@ func (self *Server) newTlsConfig() (*tls.Config, error) {
 	}
 
 	// This is *not* set with "h2" when calling Server.Serve!
-	tlsConfig.NextProtos = []string{"h2", "http/1.1"}
+	// (ACME will have already set it, together with its own protocol)
+	if len(tlsConfig.NextProtos) == 0 {
+		tlsConfig.NextProtos = []string{"h2", "http/1.1"}
+	}
+
+	if self.ClientCA != "" {
+		log.Infof("verifying client certificates with CA bundle: %s", self.ClientCA)
+		if store == nil {
+			store = NewCertificateStore(log)
+		}
+		store.ClientCAFile = self.ClientCA
+	}
+
+	tlsConfig.ClientAuth = self.ClientAuth
+
+	if store != nil {
+		if err := store.Load(); err != nil {
+			return nil, err
+		}
+
+		if store.ClientCAFile != "" {
+			tlsConfig.ClientCAs = store.ClientCAs()
+			tlsConfig.GetConfigForClient = store.newGetConfigForClient(tlsConfig)
+		}
+
+		if self.WatchCertificates {
+			if err := store.StartWatching(); err != nil {
+				return nil, err
+			}
+		}
+
+		self.certificateStore = store
+	}
 
 	return tlsConfig, nil
 }
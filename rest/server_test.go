@@ -0,0 +1,112 @@
+package rest
+
+import (
+	contextpkg "context"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/quic-go/quic-go/http3"
+)
+
+func BenchmarkEngineNetHTTP(b *testing.B) {
+	benchmarkServer(b, newBenchmarkServer(b, EngineNetHTTP, false), &http.Transport{})
+}
+
+func BenchmarkEngineFastHTTP(b *testing.B) {
+	benchmarkServer(b, newBenchmarkServer(b, EngineFastHTTP, false), &http.Transport{})
+}
+
+func BenchmarkEngineHTTP3(b *testing.B) {
+	benchmarkServer(b, newBenchmarkServer(b, EngineNetHTTP, true), &http3.RoundTripper{
+		TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
+	})
+}
+
+func newBenchmarkServer(b *testing.B, engine string, secure bool) *Server {
+	// Find a free port
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		b.Fatal(err)
+	}
+	port := listener.Addr().(*net.TCPAddr).Port
+	listener.Close()
+
+	server := NewServer("")
+	server.Engine = engine
+	server.Address = "127.0.0.1"
+	server.Port = uint64(port)
+	if secure {
+		server.TLS = true
+		server.GenerateCertificate = true
+		server.HTTP3 = true
+	}
+	server.Handler = func(restContext *Context) (bool, error) {
+		restContext.Response.ContentType = "text/plain"
+		_, err := io.WriteString(restContext.Writer, "Hello, World!\n")
+		return true, err
+	}
+
+	go func() {
+		if err := server.Start(); err != nil {
+			b.Error(err)
+		}
+	}()
+
+	b.Cleanup(func() {
+		if err := server.Stop(contextpkg.Background()); err != nil {
+			b.Error(err)
+		}
+	})
+
+	return server
+}
+
+func benchmarkServer(b *testing.B, server *Server, transport http.RoundTripper) {
+	scheme := "http"
+	if server.TLS {
+		scheme = "https"
+	}
+	url := scheme + "://" + server.AddressPort() + "/"
+
+	client := http.Client{Transport: transport}
+	defer client.CloseIdleConnections()
+
+	get := func() error {
+		response, err := client.Get(url)
+		if err != nil {
+			return err
+		}
+		defer response.Body.Close()
+		if _, err := io.Copy(io.Discard, response.Body); err != nil {
+			return err
+		}
+		if response.StatusCode != http.StatusOK {
+			return fmt.Errorf("status: %d", response.StatusCode)
+		}
+		return nil
+	}
+
+	// Wait for the server
+	deadline := time.Now().Add(5 * time.Second)
+	for err := get(); err != nil; err = get() {
+		if time.Now().After(deadline) {
+			b.Fatal(err)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			if err := get(); err != nil {
+				b.Error(err)
+				return
+			}
+		}
+	})
+}
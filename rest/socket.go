@@ -0,0 +1,146 @@
+package rest
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+)
+
+const (
+	UnixSocketPrefix       = "unix:"
+	SocketActivationPrefix = "systemd:"
+
+	DEFAULT_SOCKET_MODE = fs.FileMode(0660)
+
+	// See: https://www.freedesktop.org/software/systemd/man/latest/sd_listen_fds.html
+	socketActivationFirstFd = 3
+)
+
+func (self *Server) newUnixListener() (net.Listener, error) {
+	// Remove a stale socket left behind by a previous process, but only if
+	// nothing is listening on it anymore
+	if fileInfo, err := os.Lstat(self.Socket); err == nil {
+		if fileInfo.Mode()&fs.ModeSocket == 0 {
+			return nil, fmt.Errorf("not a socket: %s", self.Socket)
+		}
+
+		if conn, err := net.Dial("unix", self.Socket); err == nil {
+			conn.Close()
+			return nil, fmt.Errorf("socket is in use: %s", self.Socket)
+		} else if errors.Is(err, syscall.ECONNREFUSED) {
+			if err := os.Remove(self.Socket); err != nil {
+				return nil, err
+			}
+		} else {
+			return nil, err
+		}
+	}
+
+	if listener, err := net.Listen("unix", self.Socket); err == nil {
+		if err := os.Chmod(self.Socket, self.SocketMode); err == nil {
+			return listener, nil
+		} else {
+			listener.Close()
+			return nil, err
+		}
+	} else {
+		return nil, err
+	}
+}
+
+func ParseSocketMode(value any) (fs.FileMode, error) {
+	switch value_ := value.(type) {
+	case string:
+		// Always octal
+		if mode, err := strconv.ParseUint(value_, 8, 32); err == nil {
+			return fs.FileMode(mode) & fs.ModePerm, nil
+		} else {
+			return 0, fmt.Errorf("malformed socket mode: %s", value_)
+		}
+
+	case int64:
+		return fs.FileMode(value_) & fs.ModePerm, nil
+
+	case uint64:
+		return fs.FileMode(value_) & fs.ModePerm, nil
+
+	case float64:
+		return fs.FileMode(value_) & fs.ModePerm, nil
+
+	default:
+		return 0, fmt.Errorf("unsupported socket mode: %T", value)
+	}
+}
+
+//
+// Socket activation
+//
+// We keep the inherited files open for the lifetime of the process, creating
+// a new listener (with a duplicated file descriptor) whenever a server starts.
+// This allows servers to be restarted without losing the sockets.
+//
+
+type activatedSocket struct {
+	name string
+	file *os.File
+}
+
+var activatedSockets []activatedSocket
+var activatedSocketsOnce sync.Once
+
+func NewActivatedListener(name string) (net.Listener, error) {
+	activatedSocketsOnce.Do(inheritActivatedSockets)
+
+	if len(activatedSockets) == 0 {
+		return nil, errors.New("no sockets were passed via socket activation")
+	}
+
+	for _, socket := range activatedSockets {
+		if (name == "") || (socket.name == name) {
+			return net.FileListener(socket.file)
+		}
+	}
+
+	return nil, fmt.Errorf("no socket named %q was passed via socket activation", name)
+}
+
+func inheritActivatedSockets() {
+	if pid, err := strconv.Atoi(os.Getenv("LISTEN_PID")); (err != nil) || (pid != os.Getpid()) {
+		return
+	}
+
+	count, err := strconv.Atoi(os.Getenv("LISTEN_FDS"))
+	if (err != nil) || (count <= 0) {
+		return
+	}
+
+	var names []string
+	if names_ := os.Getenv("LISTEN_FDNAMES"); names_ != "" {
+		names = strings.Split(names_, ":")
+	}
+
+	for index := 0; index < count; index++ {
+		var name string
+		if index < len(names) {
+			name = names[index]
+		}
+
+		fd := socketActivationFirstFd + index
+		log.Infof("inheriting socket %d: %s", fd, name)
+		activatedSockets = append(activatedSockets, activatedSocket{
+			name: name,
+			file: os.NewFile(uintptr(fd), name),
+		})
+	}
+
+	// Don't pass them on to child processes
+	os.Unsetenv("LISTEN_PID")
+	os.Unsetenv("LISTEN_FDS")
+	os.Unsetenv("LISTEN_FDNAMES")
+}
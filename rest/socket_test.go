@@ -0,0 +1,32 @@
+package rest
+
+import (
+	"net"
+	"path/filepath"
+	"testing"
+)
+
+func TestNewUnixListener(t *testing.T) {
+	server := NewServer("")
+	server.Socket = filepath.Join(t.TempDir(), "prudence.sock")
+
+	listener, err := server.newUnixListener()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// A socket in use must not be removed
+	if listener_, err := server.newUnixListener(); err == nil {
+		listener_.Close()
+		t.Fatal("socket in use was replaced")
+	}
+
+	// Leave a stale socket behind
+	listener.(*net.UnixListener).SetUnlinkOnClose(false)
+	listener.Close()
+
+	if listener, err = server.newUnixListener(); err != nil {
+		t.Fatal(err)
+	}
+	listener.Close()
+}
@@ -0,0 +1,100 @@
+package rest
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"net/http"
+
+	"github.com/tliron/go-scriptlet/jst"
+)
+
+// Sends the status, headers, and everything written so far to the client.
+// From now on call [Context.FlushStream] to send more. Whatever is left will
+// be sent when the request ends.
+//
+// Headers cannot be changed after this call. If caching is enabled (see
+// [Context.CacheDuration]) we will keep a copy of everything we send so that
+// it can be stored when done. Otherwise the representation will not be
+// stored.
+//
+// Note that the server's handler timeout no longer applies once streaming
+// starts. Returns an error if the server cannot stream (the "fasthttp"
+// engine always buffers the whole response).
+func (self *Context) StartStreaming() error {
+	if self.Response.streaming {
+		return nil
+	}
+
+	// Encoders must decide now, before we send the Content-Encoding header
+	self.Response.streaming = true
+	if err := flushWriters(self.Writer); err != nil {
+		return err
+	}
+
+	self.Response.setContentType()
+	self.Response.setETag()
+	self.Response.setLastModified()
+	self.setCacheControl()
+	self.setVary()
+	self.setSurrogateKeys()
+
+	if self.caching() {
+		self.Response.streamed = bytes.NewBuffer(nil)
+	}
+
+	self.Response.writeHeader()
+
+	return self.sendStream()
+}
+
+// Sends everything written since the last call to the client. Will call
+// [Context.StartStreaming] if it was not called yet.
+func (self *Context) FlushStream() error {
+	if !self.Response.streaming {
+		return self.StartStreaming()
+	}
+
+	if err := flushWriters(self.Writer); err != nil {
+		return err
+	}
+
+	return self.sendStream()
+}
+
+func (self *Context) sendStream() error {
+	if self.Response.Buffer.Len() > 0 {
+		if err := self.Response.writeBuffer(); err != nil {
+			return err
+		}
+	}
+
+	if err := http.NewResponseController(self.Response.Direct).Flush(); err != nil {
+		if errors.Is(err, http.ErrNotSupported) {
+			return errors.New("streaming is not supported by this server (the response writer cannot flush, e.g. the \"fasthttp\" engine)")
+		} else {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Calls Flush on all writers in the chain, from the outermost inwards.
+func flushWriters(writer io.Writer) error {
+	for writer != nil {
+		if flusher, ok := writer.(interface{ Flush() error }); ok {
+			if err := flusher.Flush(); err != nil {
+				return err
+			}
+		}
+
+		if wrappingWriter, ok := writer.(jst.WrappingWriter); ok {
+			writer = wrappingWriter.GetWrappedWriter()
+		} else {
+			break
+		}
+	}
+
+	return nil
+}
@@ -5,6 +5,24 @@ import (
 )
 
 func RegisterDefaultTypes() {
+	platform.RegisterType("CacheAdmin", CreateCacheAdmin,
+		"readOnly",
+	)
+
+	platform.RegisterType("CacheWarmer", CreateCacheWarmer,
+		"server",
+		"handler",
+		"urls",
+		"sitemaps",
+		"generate",
+		"accept",
+		"acceptEncodings",
+		"host",
+		"concurrency",
+		"schedule",
+		"onStart",
+	)
+
 	platform.RegisterType("Cookie", CreateCookie,
 		"name",
 		"value",
@@ -17,14 +35,39 @@ func RegisterDefaultTypes() {
 		"sameSite",
 	)
 
+	platform.RegisterType("EventStream", CreateEventStream,
+		"channel",
+		"keepAlive",
+		"retry",
+		"buffer",
+	)
+
 	platform.RegisterType("Facet", CreateFacet,
 		"name",
+		"hosts",
 		"paths",
+		"methods",
+		"headers",
+		"query",
+		"contentTypes",
 		"redirectTrailingSlashStatus",
 		"variables",
 		"representations",
 	)
 
+	platform.RegisterType("Proxy", CreateProxy,
+		"upstreams",
+		"path",
+		"preserveHost",
+		"requestHeaders",
+		"responseHeaders",
+		"timeout",
+		"healthCheck",
+		"cacheDuration",
+		"cacheGroups",
+		"cacheVary",
+	)
+
 	platform.RegisterType("Representation", CreateRepresentation,
 		"name",
 		"charSet",
@@ -38,6 +81,7 @@ func RegisterDefaultTypes() {
 		"erase",
 		"modify",
 		"call",
+		"compression",
 		"contentTypes",
 		"languages",
 	)
@@ -48,9 +92,21 @@ func RegisterDefaultTypes() {
 		"facets",
 	)
 
+	platform.RegisterType("Rewrite", CreateRewrite,
+		"rules",
+		"files",
+		"handler",
+		"trustProxy",
+	)
+
 	platform.RegisterType("Route", CreateRoute,
 		"name",
+		"hosts",
 		"paths",
+		"methods",
+		"headers",
+		"query",
+		"contentTypes",
 		"redirectTrailingSlashStatus",
 		"variables",
 		"handler",
@@ -64,12 +120,17 @@ func RegisterDefaultTypes() {
 
 	platform.RegisterType("Server", CreateServer,
 		"name",
+		"engine",
 		"address",
 		"port",
+		"socketMode",
 		"protocol",
 		"tls",
+		"http3",
 		"ncsaLogFileSuffix",
 		"debug",
+		"surrogateKeys",
+		"compression",
 		"handlerTimeout",
 		"readHeaderTimeout",
 		"readTimeout",
@@ -83,4 +144,17 @@ func RegisterDefaultTypes() {
 		"indexes",
 		"presentDirectories",
 	)
+
+	platform.RegisterType("WebSocket", CreateWebSocket,
+		"subprotocols",
+		"originPatterns",
+		"rooms",
+		"readLimit",
+		"buffer",
+		"writeTimeout",
+		"hooks",
+		"open",
+		"message",
+		"close",
+	)
 }
@@ -0,0 +1,68 @@
+package rest
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"regexp"
+
+	"github.com/tliron/go-ard"
+)
+
+//
+// ValueConditions
+//
+// Maps names (of headers or query parameters) to regular expressions
+// that must match their whole first value. A nil regular expression means
+// that the name must merely be present.
+//
+
+type ValueConditions map[string]*regexp.Regexp
+
+func NewValueConditions(config ard.StringMap) (ValueConditions, error) {
+	self := make(ValueConditions)
+	for name, regex := range config {
+		if (regex == nil) || (regex == "") {
+			self[name] = nil
+		} else if regex_, err := regexp.Compile("^(?:" + fmt.Sprintf("%v", regex) + ")$"); err == nil {
+			self[name] = regex_
+		} else {
+			return nil, err
+		}
+	}
+	return self, nil
+}
+
+func (self ValueConditions) MatchHeader(header http.Header) bool {
+	for name, regex := range self {
+		if values := header.Values(name); len(values) == 0 {
+			return false
+		} else if (regex != nil) && !regex.MatchString(values[0]) {
+			return false
+		}
+	}
+	return true
+}
+
+func (self ValueConditions) MatchQuery(query url.Values) bool {
+	for name, regex := range self {
+		if !query.Has(name) {
+			return false
+		} else if (regex != nil) && !regex.MatchString(query.Get(name)) {
+			return false
+		}
+	}
+	return true
+}
+
+func getValueConditions(node *ard.Node) (ValueConditions, error) {
+	if node.Value == nil {
+		return nil, nil
+	}
+
+	if config, ok := node.StringMap(); ok {
+		return NewValueConditions(config)
+	} else {
+		return nil, fmt.Errorf("conditions not a map: %T", node.Value)
+	}
+}
@@ -0,0 +1,442 @@
+package rest
+
+import (
+	contextpkg "context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/dop251/goja"
+	"github.com/tliron/commonjs-goja"
+	"github.com/tliron/commonjs-goja/api"
+	"github.com/tliron/go-ard"
+	"github.com/tliron/kutil/util"
+	"github.com/tliron/prudence/platform"
+	"nhooyr.io/websocket"
+)
+
+const (
+	DEFAULT_WEBSOCKET_BUFFER        = 64
+	DEFAULT_WEBSOCKET_WRITE_TIMEOUT = 10 * time.Second
+)
+
+//
+// WebSocketHook
+//
+
+type WebSocketHook func(connection *WebSocketConnection, arguments ...any) error
+
+func GetWebSocketHook(value any, jsContext *commonjs.Context) (WebSocketHook, error) {
+	var err error
+	if value, jsContext, err = commonjs.Unbind(value, jsContext); err != nil {
+		return nil, err
+	}
+
+	switch hook := value.(type) {
+	case WebSocketHook:
+		return hook, nil
+
+	case goja.Value, commonjs.ExportedJavaScriptFunc:
+		return func(connection *WebSocketConnection, arguments ...any) error {
+			_, err := jsContext.Environment.Call(hook, connection, arguments...)
+			return err
+		}, nil
+	}
+
+	return nil, fmt.Errorf("not a WebSocket hook: %T", value)
+}
+
+//
+// WebSocket
+//
+
+type WebSocket struct {
+	Subprotocols   []string
+	OriginPatterns []string      // the request host is always allowed
+	Rooms          []string      // joined on open, can contain "{variable}"
+	ReadLimit      int64         // bytes per message, 0 for the default
+	Buffer         int           // messages waiting for a slow client
+	WriteTimeout   time.Duration // per message
+	Open           WebSocketHook // (this=connection)
+	Message        WebSocketHook // (this=connection, message, binary)
+	Close          WebSocketHook // (this=connection, code, reason)
+}
+
+func NewWebSocket() *WebSocket {
+	return &WebSocket{
+		Buffer:       DEFAULT_WEBSOCKET_BUFFER,
+		WriteTimeout: DEFAULT_WEBSOCKET_WRITE_TIMEOUT,
+	}
+}
+
+// ([platform.CreateFunc] signature)
+func CreateWebSocket(jsContext *commonjs.Context, config ard.StringMap) (any, error) {
+	config_ := ard.With(config).ConvertSimilar().NilMeansZero()
+
+	self := NewWebSocket()
+
+	self.Subprotocols = platform.AsStringList(config_.Get("subprotocols"))
+	self.OriginPatterns = platform.AsStringList(config_.Get("originPatterns"))
+	self.Rooms = platform.AsStringList(config_.Get("rooms"))
+
+	if readLimit, ok := config_.Get("readLimit").Integer(); ok {
+		self.ReadLimit = readLimit
+	}
+
+	if buffer, ok := config_.Get("buffer").Integer(); ok {
+		self.Buffer = int(buffer)
+	}
+
+	if writeTimeout, ok := config_.Get("writeTimeout").Float(); ok {
+		self.WriteTimeout = time.Duration(writeTimeout * float64(time.Second))
+	}
+
+	var hooks *ard.Node
+	hooksJsContext := jsContext
+	if hooks = config_.Get("hooks"); hooks.Value != nil {
+		var err error
+		if hooks.Value, hooksJsContext, err = commonjs.Unbind(hooks.Value, hooksJsContext); err != nil {
+			return nil, err
+		}
+	}
+
+	getHook := func(name string) (WebSocketHook, error) {
+		if hooks.Value != nil {
+			if hook := hooks.Get(name).Value; hook != nil {
+				return GetWebSocketHook(hook, hooksJsContext)
+			}
+		}
+
+		if hook := config_.Get(name).Value; hook != nil {
+			return GetWebSocketHook(hook, jsContext)
+		}
+
+		return nil, nil
+	}
+
+	var err error
+	if self.Open, err = getHook("open"); err != nil {
+		return nil, err
+	}
+	if self.Message, err = getHook("message"); err != nil {
+		return nil, err
+	}
+	if self.Close, err = getHook("close"); err != nil {
+		return nil, err
+	}
+
+	return self, nil
+}
+
+// ([Handler] interface, [HandleFunc] signature)
+func (self *WebSocket) Handle(restContext *Context) (bool, error) {
+	// The hijacked connection would otherwise keep the server's deadlines
+	responseController := http.NewResponseController(restContext.Response.Direct)
+	if err := responseController.SetReadDeadline(time.Time{}); err != nil {
+		restContext.Log.Debugf("cannot clear read deadline: %s", err.Error())
+	}
+	if err := responseController.SetWriteDeadline(time.Time{}); err != nil {
+		restContext.Log.Debugf("cannot clear write deadline: %s", err.Error())
+	}
+
+	if _, ok := restContext.Response.Direct.(http.Hijacker); !ok {
+		return false, errors.New("WebSocket is not supported by this server (the response writer cannot hijack the connection)")
+	}
+
+	// Accept writes the response itself
+	restContext.Response.Bypass = true
+
+	conn, err := websocket.Accept(restContext.Response.Direct, restContext.Request.Direct, &websocket.AcceptOptions{
+		Subprotocols:   self.Subprotocols,
+		OriginPatterns: self.OriginPatterns,
+	})
+	if err != nil {
+		restContext.Log.Infof("WebSocket not accepted: %s", err.Error())
+		return true, nil
+	}
+
+	if self.ReadLimit > 0 {
+		conn.SetReadLimit(self.ReadLimit)
+	}
+
+	connection := newWebSocketConnection(restContext, conn, self.Buffer, self.WriteTimeout)
+	defer connection.release()
+
+	restContext.Log.Debug("WebSocket opened")
+
+	for _, room := range self.Rooms {
+		connection.Join(restContext.expandVariables(room))
+	}
+
+	if self.Open != nil {
+		if err := self.Open(connection); err != nil {
+			connection.Close(int(websocket.StatusInternalError), "")
+			return true, err
+		}
+	}
+
+	for {
+		type_, message, err := conn.Read(connection.context)
+		if err != nil {
+			code := websocket.CloseStatus(err)
+			reason := ""
+			var closeError websocket.CloseError
+			if errors.As(err, &closeError) {
+				reason = closeError.Reason
+			}
+
+			restContext.Log.Debugf("WebSocket closed: %d %s", code, reason)
+
+			if self.Close != nil {
+				if err := self.Close(connection, int(code), reason); err != nil {
+					return true, err
+				}
+			}
+
+			return true, nil
+		}
+
+		if self.Message != nil {
+			var err error
+			if type_ == websocket.MessageText {
+				err = self.Message(connection, util.BytesToString(message), false)
+			} else {
+				err = self.Message(connection, message, true)
+			}
+
+			if err != nil {
+				connection.Close(int(websocket.StatusInternalError), "")
+				return true, err
+			}
+		}
+	}
+}
+
+//
+// WebSocketConnection
+//
+
+type WebSocketConnection struct {
+	Id        uint64
+	Context   *Context
+	Variables map[string]any // from the upgrade request, can be used for per-connection state
+
+	conn         *websocket.Conn
+	context      contextpkg.Context
+	cancel       contextpkg.CancelFunc
+	outgoing     chan webSocketMessage
+	writeTimeout time.Duration
+	rooms        map[string]struct{}
+	roomsLock    sync.Mutex
+	closeOnce    sync.Once
+}
+
+type webSocketMessage struct {
+	type_   websocket.MessageType
+	message []byte
+}
+
+func newWebSocketConnection(restContext *Context, conn *websocket.Conn, buffer int, writeTimeout time.Duration) *WebSocketConnection {
+	context, cancel := contextpkg.WithCancel(contextpkg.Background())
+	self := WebSocketConnection{
+		Id:           restContext.Id,
+		Context:      restContext,
+		Variables:    restContext.Variables,
+		conn:         conn,
+		context:      context,
+		cancel:       cancel,
+		outgoing:     make(chan webSocketMessage, buffer),
+		writeTimeout: writeTimeout,
+		rooms:        make(map[string]struct{}),
+	}
+	go self.write()
+	return &self
+}
+
+func (self *WebSocketConnection) Subprotocol() string {
+	return self.conn.Subprotocol()
+}
+
+// Strings will be sent as text, bytes as binary, and anything else will be
+// encoded as JSON and sent as text. Does not block.
+func (self *WebSocketConnection) Send(message any) error {
+	switch message_ := message.(type) {
+	case string:
+		return self.send(websocket.MessageText, util.StringToBytes(message_))
+
+	case []byte:
+		return self.send(websocket.MessageBinary, message_)
+
+	case goja.ArrayBuffer:
+		return self.send(websocket.MessageBinary, message_.Bytes())
+
+	default:
+		var transcriber api.Transcribe
+		if message__, err := transcriber.Stringify(message, "json", ""); err == nil {
+			return self.send(websocket.MessageText, util.StringToBytes(message__))
+		} else {
+			return err
+		}
+	}
+}
+
+// Strings will be sent as binary.
+func (self *WebSocketConnection) SendBinary(message any) error {
+	if message_, ok := message.(string); ok {
+		return self.send(websocket.MessageBinary, util.StringToBytes(message_))
+	}
+	return self.Send(message)
+}
+
+// Code 0 means 1000 (normal closure).
+func (self *WebSocketConnection) Close(code int, reason string) {
+	if code == 0 {
+		code = int(websocket.StatusNormalClosure)
+	}
+
+	self.closeOnce.Do(func() {
+		// The close handshake can take a while
+		go func() {
+			if err := self.conn.Close(websocket.StatusCode(code), reason); err != nil {
+				self.Context.Log.Debugf("WebSocket close: %s", err.Error())
+			}
+		}()
+	})
+}
+
+func (self *WebSocketConnection) Join(room string) {
+	self.roomsLock.Lock()
+	self.rooms[room] = struct{}{}
+	self.roomsLock.Unlock()
+
+	webSocketRooms.join(room, self)
+}
+
+func (self *WebSocketConnection) Leave(room string) {
+	self.roomsLock.Lock()
+	delete(self.rooms, room)
+	self.roomsLock.Unlock()
+
+	webSocketRooms.leave(room, self)
+}
+
+func (self *WebSocketConnection) Rooms() []string {
+	self.roomsLock.Lock()
+	defer self.roomsLock.Unlock()
+
+	rooms := make([]string, 0, len(self.rooms))
+	for room := range self.rooms {
+		rooms = append(rooms, room)
+	}
+	return rooms
+}
+
+// Sends to all other connections in the room. See [WebSocketConnection.Send].
+func (self *WebSocketConnection) Broadcast(room string, message any) {
+	broadcastWebSocket(room, message, self)
+}
+
+func (self *WebSocketConnection) send(type_ websocket.MessageType, message []byte) error {
+	select {
+	case <-self.context.Done():
+		return self.context.Err()
+
+	case self.outgoing <- webSocketMessage{type_, message}:
+		return nil
+
+	default:
+		// Too slow
+		self.Close(int(websocket.StatusPolicyViolation), "too slow")
+		return fmt.Errorf("WebSocket buffer is full: %d", self.Id)
+	}
+}
+
+func (self *WebSocketConnection) write() {
+	for {
+		select {
+		case <-self.context.Done():
+			return
+
+		case message := <-self.outgoing:
+			context, cancel := contextpkg.WithTimeout(self.context, self.writeTimeout)
+			err := self.conn.Write(context, message.type_, message.message)
+			cancel()
+			if err != nil {
+				self.Context.Log.Debugf("WebSocket write: %s", err.Error())
+				self.Close(int(websocket.StatusGoingAway), "")
+				return
+			}
+		}
+	}
+}
+
+func (self *WebSocketConnection) release() {
+	for _, room := range self.Rooms() {
+		webSocketRooms.leave(room, self)
+	}
+	self.cancel()
+	self.conn.CloseNow()
+}
+
+// Sends to all connections in the room. See [WebSocketConnection.Send].
+func BroadcastWebSocket(room string, message any) {
+	broadcastWebSocket(room, message, nil)
+}
+
+func broadcastWebSocket(room string, message any, except *WebSocketConnection) {
+	for _, connection := range webSocketRooms.connections(room) {
+		if connection != except {
+			if err := connection.Send(message); err != nil {
+				connection.Context.Log.Debugf("WebSocket broadcast: %s", err.Error())
+			}
+		}
+	}
+}
+
+//
+// webSocketRoomRegistry
+//
+
+var webSocketRooms = webSocketRoomRegistry{rooms: make(map[string]map[*WebSocketConnection]struct{})}
+
+type webSocketRoomRegistry struct {
+	rooms map[string]map[*WebSocketConnection]struct{}
+	lock  sync.RWMutex
+}
+
+func (self *webSocketRoomRegistry) join(room string, connection *WebSocketConnection) {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+
+	connections, ok := self.rooms[room]
+	if !ok {
+		connections = make(map[*WebSocketConnection]struct{})
+		self.rooms[room] = connections
+	}
+	connections[connection] = struct{}{}
+}
+
+func (self *webSocketRoomRegistry) leave(room string, connection *WebSocketConnection) {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+
+	if connections, ok := self.rooms[room]; ok {
+		delete(connections, connection)
+		if len(connections) == 0 {
+			delete(self.rooms, room)
+		}
+	}
+}
+
+func (self *webSocketRoomRegistry) connections(room string) []*WebSocketConnection {
+	self.lock.RLock()
+	defer self.lock.RUnlock()
+
+	connections := make([]*WebSocketConnection, 0, len(self.rooms[room]))
+	for connection := range self.rooms[room] {
+		connections = append(connections, connection)
+	}
+	return connections
+}
@@ -74,6 +74,74 @@ func (self *TieredCacheBackend) DeleteGroup(name platform.CacheKey) {
 	}
 }
 
+// ([platform.CacheInspector] interface)
+func (self *TieredCacheBackend) IterateEntries(iterate func(entry *platform.CacheEntry) bool) {
+	// The same key might be in several tiers
+	keys := make(map[platform.CacheKey]struct{})
+	for _, cacheBackend := range self.cacheBackends {
+		if cacheInspector, ok := cacheBackend.(platform.CacheInspector); ok {
+			stopped := false
+			cacheInspector.IterateEntries(func(entry *platform.CacheEntry) bool {
+				if _, ok := keys[entry.Key]; ok {
+					return true
+				}
+				keys[entry.Key] = struct{}{}
+				if !iterate(entry) {
+					stopped = true
+				}
+				return !stopped
+			})
+			if stopped {
+				return
+			}
+		}
+	}
+}
+
+// ([platform.CacheInspector] interface)
+func (self *TieredCacheBackend) GetMetrics() map[string]any {
+	tiers := make([]any, len(self.cacheBackends))
+	for index, cacheBackend := range self.cacheBackends {
+		if cacheInspector, ok := cacheBackend.(platform.CacheInspector); ok {
+			tiers[index] = cacheInspector.GetMetrics()
+		}
+	}
+	return map[string]any{
+		"tiers": tiers,
+	}
+}
+
+// Only the first tier that is a [platform.CacheCoalescer] is used, so that
+// joining and leaving always go to the same one.
+//
+// ([platform.CacheCoalescer] interface)
+func (self *TieredCacheBackend) JoinRendering(key platform.CacheKey) *platform.Flight {
+	if cacheCoalescer := self.cacheCoalescer(); cacheCoalescer != nil {
+		return cacheCoalescer.JoinRendering(key)
+	}
+	return nil
+}
+
+// ([platform.CacheCoalescer] interface)
+func (self *TieredCacheBackend) LeaveRendering(key platform.CacheKey) {
+	if cacheCoalescer := self.cacheCoalescer(); cacheCoalescer != nil {
+		cacheCoalescer.LeaveRendering(key)
+	}
+}
+
+// Only the first tier that is a [platform.EventRelay] is used, so that other
+// nodes receive each event once.
+//
+// ([platform.EventRelay] interface)
+func (self *TieredCacheBackend) RelayEvent(event *platform.Event) {
+	for _, cacheBackend := range self.cacheBackends {
+		if eventRelay, ok := cacheBackend.(platform.EventRelay); ok {
+			eventRelay.RelayEvent(event)
+			return
+		}
+	}
+}
+
 // platform.HasStartables interface
 func (self *TieredCacheBackend) GetStartables() []platform.Startable {
 	var startables []platform.Startable
@@ -84,3 +152,12 @@ func (self *TieredCacheBackend) GetStartables() []platform.Startable {
 	}
 	return startables
 }
+
+func (self *TieredCacheBackend) cacheCoalescer() platform.CacheCoalescer {
+	for _, cacheBackend := range self.cacheBackends {
+		if cacheCoalescer, ok := cacheBackend.(platform.CacheCoalescer); ok {
+			return cacheCoalescer
+		}
+	}
+	return nil
+}